@@ -0,0 +1,439 @@
+//go:build linux
+
+// Package cgroup limits the CPU, memory and processes of workspace sessions
+// with a cgroup v2 child per workspace, created in the subtree delegated to
+// the current user.
+package cgroup
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/repo-scm/git/mount"
+)
+
+const (
+	// group holds the cgroups of all workspaces below the delegated one
+	group = "repo-scm"
+	// cpuPeriod is the period of cpu.max in microseconds
+	cpuPeriod = 100000
+)
+
+// ErrUnavailable is returned when no cgroup can be created for the current
+// user, such as without cgroup v2 or when it is not delegated.
+var ErrUnavailable = errors.New("cgroup delegation not available")
+
+// Limits caps a workspace. Zero values mean no limit.
+type Limits struct {
+	CPUs   float64
+	Memory int64
+	Pids   int64
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool {
+	return l.CPUs == 0 && l.Memory == 0 && l.Pids == 0
+}
+
+// Usage is what the sessions of a workspace use right now, with the limits
+// they run under. Zero limits mean none.
+type Usage struct {
+	CPUTime   time.Duration `json:"cpu_time" yaml:"cpu_time"`
+	CPUs      float64       `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	Memory    int64         `json:"memory" yaml:"memory"`
+	MemoryMax int64         `json:"memory_max,omitempty" yaml:"memory_max,omitempty"`
+	Pids      int64         `json:"pids" yaml:"pids"`
+	PidsMax   int64         `json:"pids_max,omitempty" yaml:"pids_max,omitempty"`
+}
+
+// Cgroup is the cgroup of one workspace.
+type Cgroup struct {
+	Path string
+}
+
+// Create returns the cgroup of workspace name with limits applied, creating
+// it if needed. Limits of controllers that are not delegated are skipped and
+// reported in skipped.
+func Create(name string, limits Limits) (cg *Cgroup, skipped []string, err error) {
+	base, err := delegated()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	available := map[string]bool{}
+	for _, item := range strings.Fields(readFile(filepath.Join(base, "cgroup.controllers"))) {
+		available[item] = true
+	}
+
+	var controllers []string
+
+	for _, item := range []struct {
+		controller string
+		set        bool
+	}{
+		{"cpu", limits.CPUs > 0},
+		{"memory", limits.Memory > 0},
+		{"pids", limits.Pids > 0},
+	} {
+		if !item.set {
+			continue
+		}
+		if available[item.controller] {
+			controllers = append(controllers, item.controller)
+		} else {
+			skipped = append(skipped, item.controller)
+		}
+	}
+
+	if len(controllers) == 0 {
+		return nil, skipped, errors.Wrapf(ErrUnavailable, "controller %s not available in %s", strings.Join(skipped, ", "), base)
+	}
+
+	parent := filepath.Join(base, group)
+	cg = &Cgroup{Path: filepath.Join(parent, name)}
+
+	if err := enable(base, controllers); err != nil {
+		return nil, skipped, err
+	}
+
+	if err := os.Mkdir(parent, 0755); err != nil && !os.IsExist(err) {
+		return nil, skipped, errors.Wrap(err, "failed to create cgroup")
+	}
+
+	if err := enable(parent, controllers); err != nil {
+		return nil, skipped, err
+	}
+
+	if err := os.Mkdir(cg.Path, 0755); err != nil && !os.IsExist(err) {
+		return nil, skipped, errors.Wrap(err, "failed to create cgroup")
+	}
+
+	if err := writeLimits(cg.Path, limits, controllers); err != nil {
+		return nil, skipped, err
+	}
+
+	return cg, skipped, nil
+}
+
+// writeLimits sets the limits of controllers in dir. The cgroup outlives the
+// session that made it, so every other controller enabled there is reset to
+// max instead of keeping the limit of an earlier session.
+func writeLimits(dir string, limits Limits, controllers []string) error {
+	for _, item := range []struct {
+		controller string
+		file       string
+		value      string
+	}{
+		{"cpu", "cpu.max", formatCPUMax(limits.CPUs)},
+		{"memory", "memory.max", strconv.FormatInt(limits.Memory, 10)},
+		{"pids", "pids.max", strconv.FormatInt(limits.Pids, 10)},
+	} {
+		name := filepath.Join(dir, item.file)
+		value := item.value
+		if !slices.Contains(controllers, item.controller) {
+			if _, err := os.Stat(name); err != nil {
+				continue
+			}
+			value = "max"
+		}
+		if err := os.WriteFile(name, []byte(value), 0); err != nil {
+			return errors.Wrapf(err, "failed to set %s", item.file)
+		}
+	}
+
+	return nil
+}
+
+// Open returns the cgroup of workspace name, or nil if it has none, which is
+// the case while no session of it runs.
+func Open(name string) (*Cgroup, error) {
+	base, err := delegated()
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &Cgroup{Path: filepath.Join(base, group, name)}
+
+	if _, err := os.Stat(cg.Path); err != nil {
+		return nil, nil
+	}
+
+	return cg, nil
+}
+
+// Attach makes cmd start in the cgroup, so the limits hold from its first
+// instruction on. close has to be called once cmd is started. Starting in a
+// cgroup needs clone3 with CLONE_INTO_CGROUP from Linux 5.7, without it the
+// error wraps ENOSYS.
+func (c *Cgroup) Attach(cmd *exec.Cmd) (close func(), err error) {
+	if err := cloneIntoCgroup(); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Open(c.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open cgroup")
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+	return func() { _ = dir.Close() }, nil
+}
+
+// cloneIntoCgroup reports whether processes can be started in a cgroup. An
+// old kernel, or a seccomp filter of a container, fails clone3 with ENOSYS,
+// which is probed with arguments the kernel rejects before forking.
+func cloneIntoCgroup() error {
+	var uts unix.Utsname
+
+	if err := unix.Uname(&uts); err == nil {
+		if release := unix.ByteSliceToString(uts.Release[:]); !kernelAtLeast(release, 5, 7) {
+			return errors.Wrapf(syscall.ENOSYS, "starting in a cgroup needs Linux 5.7, running %s", release)
+		}
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_CLONE3, 0, 0, 0); errno == unix.ENOSYS {
+		return errors.Wrap(syscall.ENOSYS, "clone3 not available")
+	}
+
+	return nil
+}
+
+// kernelAtLeast reports whether a kernel release like 5.15.0-91-generic is
+// at least major.minor. Releases that cannot be parsed count as new enough.
+func kernelAtLeast(release string, major, minor int) bool {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return true
+	}
+
+	gotMajor, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return true
+	}
+
+	digits := strings.IndexFunc(fields[1], func(r rune) bool { return r < '0' || r > '9' })
+	if digits < 0 {
+		digits = len(fields[1])
+	}
+
+	gotMinor, err := strconv.Atoi(fields[1][:digits])
+	if err != nil {
+		return true
+	}
+
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// Remove removes the cgroup once no process is left in it. It is kept while
+// other sessions of the workspace still run.
+func (c *Cgroup) Remove() error {
+	if err := syscall.Rmdir(c.Path); err != nil && !errors.Is(err, syscall.EBUSY) && !errors.Is(err, syscall.ENOENT) {
+		return errors.Wrap(err, "failed to remove cgroup")
+	}
+
+	return nil
+}
+
+// Populated reports whether any process still runs in the cgroup.
+func (c *Cgroup) Populated() bool {
+	for _, line := range strings.Split(readFile(filepath.Join(c.Path, "cgroup.events")), "\n") {
+		if value, ok := strings.CutPrefix(line, "populated "); ok {
+			return value != "0"
+		}
+	}
+
+	return false
+}
+
+// Usage reads the usage and limits of the cgroup.
+func (c *Cgroup) Usage() Usage {
+	var usage Usage
+
+	for _, line := range strings.Split(readFile(filepath.Join(c.Path, "cpu.stat")), "\n") {
+		if value, ok := strings.CutPrefix(line, "usage_usec "); ok {
+			usec, _ := strconv.ParseInt(value, 10, 64)
+			usage.CPUTime = time.Duration(usec) * time.Microsecond
+		}
+	}
+
+	usage.CPUs = parseCPUMax(readFile(filepath.Join(c.Path, "cpu.max")))
+	usage.Memory = parseMax(readFile(filepath.Join(c.Path, "memory.current")))
+	usage.MemoryMax = parseMax(readFile(filepath.Join(c.Path, "memory.max")))
+	usage.Pids = parseMax(readFile(filepath.Join(c.Path, "pids.current")))
+	usage.PidsMax = parseMax(readFile(filepath.Join(c.Path, "pids.max")))
+
+	return usage
+}
+
+// delegated returns the topmost cgroup above the current process that the
+// current user owns. Creating cgroups there and moving processes into them
+// needs no privileges, see "Delegation Containment" in cgroup-v2.rst.
+func delegated() (string, error) {
+	root, err := mountpoint()
+	if err != nil {
+		return "", err
+	}
+
+	current, err := own()
+	if err != nil {
+		return "", err
+	}
+
+	var base string
+
+	for dir := filepath.Join(root, current); strings.HasPrefix(dir+"/", root+"/"); dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err != nil {
+			break
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Geteuid() {
+			break
+		}
+		base = dir
+		if dir == root {
+			break
+		}
+	}
+
+	if base == "" {
+		return "", errors.Wrapf(ErrUnavailable, "cgroup %s is not delegated to user %d", current, os.Geteuid())
+	}
+
+	return base, nil
+}
+
+// mountpoint returns where the cgroup v2 hierarchy is mounted, which is not
+// always /sys/fs/cgroup on hosts still using cgroup v1.
+func mountpoint() (string, error) {
+	mounts, err := mount.Mounts()
+	if err != nil {
+		return "", err
+	}
+
+	for _, item := range mounts {
+		if item.FSType == "cgroup2" {
+			return item.Mountpoint, nil
+		}
+	}
+
+	return "", errors.Wrap(ErrUnavailable, "cgroup v2 is not mounted")
+}
+
+// own returns the cgroup v2 path of the current process.
+func own() (string, error) {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read cgroup")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if current, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return current, nil
+		}
+	}
+
+	return "", errors.Wrap(ErrUnavailable, "process is in no cgroup v2")
+}
+
+// enable makes controllers available to the children of dir.
+func enable(dir string, controllers []string) error {
+	enabled := strings.Fields(readFile(filepath.Join(dir, "cgroup.subtree_control")))
+
+	var missing []string
+
+	for _, item := range controllers {
+		if !slices.Contains(enabled, item) {
+			missing = append(missing, "+"+item)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(missing, " ")), 0); err != nil {
+		// Controllers cannot be enabled for the children of a cgroup with processes in it
+		return errors.Wrapf(ErrUnavailable, "failed to enable %s in %s: %v", strings.Join(controllers, ", "), dir, err)
+	}
+
+	return nil
+}
+
+func formatCPUMax(cpus float64) string {
+	return strconv.FormatInt(int64(cpus*cpuPeriod), 10) + " " + strconv.Itoa(cpuPeriod)
+}
+
+// parseCPUMax returns the CPUs allowed by cpu.max, or zero for no limit.
+func parseCPUMax(s string) float64 {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0
+	}
+
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period == 0 {
+		return 0
+	}
+
+	return quota / period
+}
+
+// parseMax parses a counter or limit, with max and missing files as zero.
+func parseMax(s string) int64 {
+	value, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return value
+}
+
+// ParseMemory parses a size in bytes, or with a K, M, G or T suffix of binary
+// units, like 512M or 1.5G.
+func ParseMemory(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+
+	multiplier := float64(1)
+
+	if n := len(value); n > 0 {
+		if exp := strings.IndexByte("KMGT", value[n-1]); exp >= 0 {
+			multiplier = float64(int64(1) << (10 * (exp + 1)))
+			value = value[:n-1]
+		}
+	}
+
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size <= 0 {
+		return 0, errors.Errorf("invalid memory size %s", s)
+	}
+
+	return int64(size * multiplier), nil
+}
+
+func readFile(name string) string {
+	buf, _ := os.ReadFile(name)
+	return strings.TrimSpace(string(buf))
+}
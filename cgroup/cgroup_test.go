@@ -0,0 +1,121 @@
+//go:build linux
+
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"1024", 1024},
+		{"512K", 512 << 10},
+		{"512M", 512 << 20},
+		{"512MiB", 512 << 20},
+		{"4g", 4 << 30},
+		{"1.5G", 3 << 29},
+		{"1T", 1 << 40},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMemory(test.input)
+		if err != nil {
+			t.Errorf("ParseMemory(%q) failed: %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseMemory(%q) = %d, want %d", test.input, got, test.want)
+		}
+	}
+
+	for _, input := range []string{"", "G", "-1G", "0", "12Q", "max"} {
+		if _, err := ParseMemory(input); err == nil {
+			t.Errorf("ParseMemory(%q) succeeded, want error", input)
+		}
+	}
+}
+
+func TestCPUMax(t *testing.T) {
+	for _, cpus := range []float64{0.5, 1, 2.25} {
+		if got := parseCPUMax(formatCPUMax(cpus)); got != cpus {
+			t.Errorf("parseCPUMax(formatCPUMax(%g)) = %g", cpus, got)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"max 100000", 0},
+		{"50000 100000", 0.5},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		if got := parseCPUMax(test.input); got != test.want {
+			t.Errorf("parseCPUMax(%q) = %g, want %g", test.input, got, test.want)
+		}
+	}
+}
+
+func TestWriteLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	// An earlier session left limits on every controller
+	for file, value := range map[string]string{"cpu.max": "50000 100000", "memory.max": "1024", "pids.max": "10"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writeLimits(dir, Limits{Pids: 64}, []string{"pids"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"cpu.max": "max", "memory.max": "max", "pids.max": "64"}
+
+	for file, value := range want {
+		if got := readFile(filepath.Join(dir, file)); got != value {
+			t.Errorf("%s = %q, want %q", file, got, value)
+		}
+	}
+
+	// Controllers not enabled in the cgroup have no files to reset
+	other := t.TempDir()
+
+	if err := writeLimits(other, Limits{CPUs: 1}, []string{"cpu"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, _ := os.ReadDir(other); len(entries) != 1 {
+		t.Errorf("writeLimits() created %v, want only cpu.max", entries)
+	}
+}
+
+func TestKernelAtLeast(t *testing.T) {
+	tests := []struct {
+		release string
+		want    bool
+	}{
+		{"5.7.0", true},
+		{"5.15.0-91-generic", true},
+		{"6.1.0", true},
+		{"5.6.19", false},
+		{"5.4.0-150-generic", false},
+		{"4.19.0", false},
+		{"5.10-rc1", true},
+		{"5.6-rc1", false},
+		{"unknown", true},
+	}
+
+	for _, test := range tests {
+		if got := kernelAtLeast(test.release, 5, 7); got != test.want {
+			t.Errorf("kernelAtLeast(%q, 5, 7) = %v, want %v", test.release, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/repo-scm/git/provider"
+	"github.com/repo-scm/git/tools"
+)
+
+const (
+	MaxToolSteps = 25
+)
+
+var agentTools = []string{
+	"read_file",
+	"list_dir",
+	"grep",
+	"write_file",
+	"apply_patch",
+	"run_command",
+}
+
+// Agent executes the tool calls requested by the model inside a workspace
+// root. Tools that change the workspace only run once Confirm allows them.
+type Agent struct {
+	Root    string
+	Tools   []tools.Tool
+	Confirm func(call provider.ToolCall) bool
+
+	// Sandboxed is set once run_command is confined to the root
+	Sandboxed bool
+}
+
+func NewAgent(root string, confirm func(call provider.ToolCall) bool) *Agent {
+	var list []tools.Tool
+
+	for _, name := range agentTools {
+		if item, ok := tools.Find(tools.Builtin(), name); ok {
+			list = append(list, item)
+		}
+	}
+
+	return &Agent{
+		Root:    root,
+		Tools:   list,
+		Confirm: confirm,
+	}
+}
+
+// Sandbox makes run_command run in a sandbox where the root is the only
+// writable directory.
+func (a *Agent) Sandbox() {
+	a.Tools = tools.Sandboxed(a.Tools)
+	a.Sandboxed = true
+}
+
+func (a *Agent) Specs() []provider.ToolSpec {
+	var specs []provider.ToolSpec
+
+	for _, item := range a.Tools {
+		var spec provider.ToolSpec
+		spec.Type = "function"
+		spec.Function.Name = item.Name
+		spec.Function.Description = item.Description
+		spec.Function.Parameters = item.Schema
+		specs = append(specs, spec)
+	}
+
+	return specs
+}
+
+// Run executes call and returns the tool message answering it. Failures are
+// reported back to the model rather than aborting the turn.
+func (a *Agent) Run(ctx context.Context, call provider.ToolCall) provider.Message {
+	reply := func(content string) provider.Message {
+		if content == "" {
+			content = "(no output)"
+		}
+		return provider.Message{
+			Role:       provider.RoleTool,
+			Content:    content,
+			ToolCallID: call.ID,
+		}
+	}
+
+	tool, ok := tools.Find(a.Tools, call.Function.Name)
+	if !ok {
+		return reply(fmt.Sprintf("error: unknown tool %s", call.Function.Name))
+	}
+
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) > 0 && !json.Valid(args) {
+		return reply("error: arguments are not valid JSON")
+	}
+
+	if !tool.ReadOnly && a.Confirm != nil && !a.Confirm(call) {
+		return reply("error: the user declined this action")
+	}
+
+	output, err := tool.Run(ctx, a.Root, args)
+	if err != nil {
+		return reply("error: " + err.Error())
+	}
+
+	return reply(output)
+}
@@ -0,0 +1,336 @@
+//go:build linux
+
+package chat
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/provider"
+	"github.com/repo-scm/git/tools"
+)
+
+const (
+	DefaultContextBudget = 48000
+)
+
+// ContextBuilder renders what the model should know about a workspace: its
+// file tree, the upper layer diff against lower, and attached files.
+type ContextBuilder struct {
+	Root   string
+	Upper  string
+	Lowers []string
+	Budget int
+
+	files []string
+}
+
+type section struct {
+	title string
+	body  string
+}
+
+func NewContextBuilder(root, upper string, lowers []string) *ContextBuilder {
+	return &ContextBuilder{
+		Root:   root,
+		Upper:  upper,
+		Lowers: lowers,
+		Budget: DefaultContextBudget,
+	}
+}
+
+// Add attaches a file, or every tracked file below a directory, skipping
+// anything matched by .gitignore.
+func (b *ContextBuilder) Add(ctx context.Context, name string) ([]string, error) {
+	target, err := tools.Resolve(b.Root, name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, _ := filepath.Rel(b.Root, target)
+
+	var candidates []string
+
+	if info.IsDir() {
+		files, err := b.listFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range files {
+			if rel == "." || strings.HasPrefix(item, rel+"/") {
+				candidates = append(candidates, item)
+			}
+		}
+	} else {
+		if b.ignored(ctx, rel) {
+			return nil, errors.Errorf("%s is ignored by .gitignore", name)
+		}
+		candidates = append(candidates, rel)
+	}
+
+	var added []string
+
+	for _, item := range candidates {
+		if !b.attached(item) {
+			b.files = append(b.files, item)
+			added = append(added, item)
+		}
+	}
+
+	return added, nil
+}
+
+// Drop detaches a file, or every attached file below a directory.
+func (b *ContextBuilder) Drop(name string) []string {
+	rel := filepath.Clean(name)
+	if filepath.IsAbs(rel) {
+		if r, err := filepath.Rel(b.Root, rel); err == nil {
+			rel = r
+		}
+	}
+
+	var kept, dropped []string
+
+	for _, item := range b.files {
+		if item == rel || rel == "." || strings.HasPrefix(item, rel+"/") {
+			dropped = append(dropped, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+
+	b.files = kept
+
+	return dropped
+}
+
+func (b *ContextBuilder) Files() []string {
+	return append([]string(nil), b.files...)
+}
+
+// Build renders the context within Budget chars. Attached files are filled
+// first, then the diff, then the file tree, so what the user picked survives.
+func (b *ContextBuilder) Build(ctx context.Context) (string, error) {
+	remaining := b.Budget
+	if remaining <= 0 {
+		remaining = DefaultContextBudget
+	}
+
+	attached := b.renderFiles(&remaining)
+
+	var diff string
+	if b.Upper != "" && len(b.Lowers) > 0 {
+		var err error
+		if diff, err = b.renderDiff(ctx); err != nil {
+			return "", err
+		}
+		if diff = fit(diff, &remaining); diff != "" {
+			diff = "```diff\n" + diff + "\n```"
+		}
+	}
+
+	files, err := b.listFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+	tree := fit(strings.Join(files, "\n"), &remaining)
+
+	sections := []section{
+		{"Repository files", tree},
+		{"Changes in workspace (upper layer against lower)", diff},
+		{"Attached files", attached},
+	}
+
+	var out strings.Builder
+
+	_, _ = fmt.Fprintf(&out, "The workspace is mounted at %s.\n", b.Root)
+
+	for _, item := range sections {
+		if item.body == "" {
+			continue
+		}
+		_, _ = fmt.Fprintf(&out, "\n## %s\n\n%s\n", item.title, item.body)
+	}
+
+	return out.String(), nil
+}
+
+func (b *ContextBuilder) renderFiles(remaining *int) string {
+	var out strings.Builder
+
+	for _, item := range b.files {
+		buf, err := os.ReadFile(filepath.Join(b.Root, item))
+		if err != nil {
+			_, _ = fmt.Fprintf(&out, "### %s\n\n(unreadable: %v)\n\n", item, err)
+			continue
+		}
+		body := fmt.Sprintf("### %s\n\n```\n%s\n```\n\n", item, strings.TrimRight(string(buf), "\n"))
+		if len(body) > *remaining {
+			_, _ = fmt.Fprintf(&out, "### %s\n\n(omitted: exceeds context budget)\n\n", item)
+			continue
+		}
+		*remaining -= len(body)
+		out.WriteString(body)
+	}
+
+	return strings.TrimRight(out.String(), "\n")
+}
+
+func (b *ContextBuilder) renderDiff(ctx context.Context) (string, error) {
+	all, err := overlay.Changes(b.Upper, b.Lowers...)
+	if err != nil {
+		return "", err
+	}
+
+	var paths []string
+	for _, item := range all {
+		paths = append(paths, item.Path)
+	}
+
+	ignored := b.ignoredSet(ctx, paths)
+
+	var changes []overlay.Change
+	for _, item := range all {
+		if item.Path == ".git" || strings.HasPrefix(item.Path, ".git/") || ignored[item.Path] {
+			continue
+		}
+		changes = append(changes, item)
+	}
+
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	var out strings.Builder
+
+	if err := overlay.WriteDiff(&out, b.Upper, b.Lowers, changes); err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// Inject places the workspace context right after the system prompt so it is
+// refreshed on every turn without being stored in the history.
+func Inject(messages []provider.Message, text string) []provider.Message {
+	if text == "" {
+		return messages
+	}
+
+	i := 0
+	for i < len(messages) && messages[i].Role == provider.RoleSystem {
+		i++
+	}
+
+	out := make([]provider.Message, 0, len(messages)+1)
+	out = append(out, messages[:i]...)
+	out = append(out, provider.Message{Role: provider.RoleSystem, Content: text})
+	out = append(out, messages[i:]...)
+
+	return out
+}
+
+// listFiles lists workspace files honoring .gitignore when the workspace is a
+// git repository, and walks the tree otherwise.
+func (b *ContextBuilder) listFiles(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "ls-files", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = b.Root
+
+	if output, err := cmd.Output(); err == nil {
+		files := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if len(files) == 1 && files[0] == "" {
+			return nil, nil
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+
+	var files []string
+
+	err := filepath.WalkDir(b.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(b.Root, p)
+			files = append(files, rel)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+func (b *ContextBuilder) ignored(ctx context.Context, rel string) bool {
+	return b.ignoredSet(ctx, []string{rel})[rel]
+}
+
+func (b *ContextBuilder) ignoredSet(ctx context.Context, paths []string) map[string]bool {
+	ignored := map[string]bool{}
+
+	if len(paths) == 0 {
+		return ignored
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "check-ignore", "--stdin")
+	cmd.Dir = b.Root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+
+	// Exit status 1 only means nothing matched
+	output, _ := cmd.Output()
+
+	for _, item := range strings.Split(string(output), "\n") {
+		if item != "" {
+			ignored[item] = true
+		}
+	}
+
+	return ignored
+}
+
+func (b *ContextBuilder) attached(rel string) bool {
+	for _, item := range b.files {
+		if item == rel {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fit(s string, remaining *int) string {
+	if s == "" || *remaining <= 0 {
+		return ""
+	}
+
+	if len(s) > *remaining {
+		// Cut before a character rather than in the middle of it
+		cut := *remaining
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "\n... (truncated to fit context budget)"
+	}
+
+	*remaining -= len(s)
+
+	return s
+}
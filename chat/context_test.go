@@ -0,0 +1,35 @@
+//go:build linux
+
+package chat
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		input  string
+		budget int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc"},
+		{"añb", 2, "a"},
+		{"日本語", 4, "日"},
+		{"日本語", 2, ""},
+		{"", 10, ""},
+	}
+
+	for _, test := range tests {
+		remaining := test.budget
+		got := fit(test.input, &remaining)
+		if !utf8.ValidString(got) {
+			t.Errorf("fit(%q, %d) = %q, not valid UTF-8", test.input, test.budget, got)
+		}
+		if body, _, _ := strings.Cut(got, "\n..."); body != test.want {
+			t.Errorf("fit(%q, %d) kept %q, want %q", test.input, test.budget, body, test.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+//go:build linux
+
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/provider"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	DefaultBudget = 64000
+)
+
+// Conversation accumulates the turns of a chat session. The full history is
+// persisted, while Window trims what is sent to the model to Budget chars.
+type Conversation struct {
+	ID        string             `json:"id"`
+	Workspace string             `json:"workspace"`
+	Model     string             `json:"model"`
+	Messages  []provider.Message `json:"messages"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+
+	Budget int `json:"-"`
+	dir    string
+}
+
+func NewConversation(dir, workspace, system string) *Conversation {
+	now := time.Now()
+
+	c := &Conversation{
+		ID:        newSessionID(now),
+		Workspace: workspace,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Budget:    DefaultBudget,
+		dir:       dir,
+	}
+
+	if system != "" {
+		c.Add(provider.RoleSystem, system)
+	}
+
+	return c
+}
+
+func LoadConversation(dir, id string) (*Conversation, error) {
+	if id == "" || strings.ContainsAny(id, "/\\") {
+		return nil, errors.Errorf("invalid session %q", id)
+	}
+
+	buf, err := os.ReadFile(path.Join(dir, id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("session %s not found", id)
+		}
+		return nil, errors.Wrap(err, "failed to read session")
+	}
+
+	c := &Conversation{
+		Budget: DefaultBudget,
+		dir:    dir,
+	}
+
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse session %s", id)
+	}
+
+	return c, nil
+}
+
+// ListConversations returns the saved sessions in dir, most recent first.
+func ListConversations(dir string) ([]*Conversation, error) {
+	var list []*Conversation
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, item := range entries {
+		id, ok := strings.CutSuffix(item.Name(), ".json")
+		if !ok || item.IsDir() {
+			continue
+		}
+		c, err := LoadConversation(dir, id)
+		if err != nil {
+			continue
+		}
+		list = append(list, c)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+
+	return list, nil
+}
+
+func (c *Conversation) Add(role, content string) {
+	c.Append(provider.Message{Role: role, Content: content})
+}
+
+func (c *Conversation) Append(message provider.Message) {
+	c.Messages = append(c.Messages, message)
+	c.UpdatedAt = time.Now()
+}
+
+// Pop drops the last message, used to forget a turn that never got a reply.
+func (c *Conversation) Pop() {
+	if len(c.Messages) > 0 {
+		c.Messages = c.Messages[:len(c.Messages)-1]
+	}
+}
+
+// Reset forgets every turn but the system prompt.
+func (c *Conversation) Reset() {
+	var kept []provider.Message
+
+	for _, item := range c.Messages {
+		if item.Role == provider.RoleSystem {
+			kept = append(kept, item)
+		}
+	}
+
+	c.Messages = kept
+	c.UpdatedAt = time.Now()
+}
+
+// Window returns the system messages plus as many of the most recent turns as
+// fit in Budget chars, counting every part of a message sent to the model. An
+// assistant message calling tools is kept or dropped together with their
+// results, and the latest turn is always kept.
+func (c *Conversation) Window() []provider.Message {
+	var system []provider.Message
+	var groups [][]provider.Message
+
+	used := 0
+
+	for _, item := range c.Messages {
+		switch {
+		case item.Role == provider.RoleSystem:
+			system = append(system, item)
+			used += messageSize(item)
+		case item.Role == provider.RoleTool && len(groups) > 0:
+			// Results follow the assistant message that called for them
+			groups[len(groups)-1] = append(groups[len(groups)-1], item)
+		default:
+			groups = append(groups, []provider.Message{item})
+		}
+	}
+
+	first := len(groups)
+
+	for first > 0 {
+		size := 0
+		for _, item := range groups[first-1] {
+			size += messageSize(item)
+		}
+		if c.Budget > 0 && used+size > c.Budget && first < len(groups) {
+			break
+		}
+		used += size
+		first--
+	}
+
+	// Never open the window with a dangling assistant reply or tool result
+	for first < len(groups)-1 && groups[first][0].Role != provider.RoleUser {
+		first++
+	}
+
+	messages := append([]provider.Message(nil), system...)
+
+	for _, group := range groups[first:] {
+		messages = append(messages, group...)
+	}
+
+	return messages
+}
+
+// messageSize returns the length of message as sent to the model, with its
+// tool calls and their arguments.
+func messageSize(message provider.Message) int {
+	buf, err := json.Marshal(message)
+	if err != nil {
+		return len(message.Content)
+	}
+
+	return len(buf)
+}
+
+func (c *Conversation) Dir() string {
+	return c.dir
+}
+
+// Turns counts the user, assistant and tool messages.
+func (c *Conversation) Turns() int {
+	n := 0
+
+	for _, item := range c.Messages {
+		if item.Role != provider.RoleSystem {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (c *Conversation) Save() error {
+	if c.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, utils.PermDir); err != nil {
+		return errors.Wrap(err, "failed to create session directory")
+	}
+
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(c.dir, c.ID+".json")
+
+	if err := os.WriteFile(name+".tmp", buf, utils.PermFile); err != nil {
+		return errors.Wrap(err, "failed to write session")
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+func newSessionID(now time.Time) string {
+	buf := make([]byte, 2)
+	_, _ = rand.Read(buf)
+
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
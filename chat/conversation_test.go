@@ -0,0 +1,86 @@
+//go:build linux
+
+package chat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/repo-scm/git/provider"
+)
+
+func toolCall(id, arguments string) provider.Message {
+	call := provider.ToolCall{ID: id, Type: "function"}
+	call.Function.Name = "read_file"
+	call.Function.Arguments = arguments
+
+	return provider.Message{Role: provider.RoleAssistant, ToolCalls: []provider.ToolCall{call}}
+}
+
+func TestWindow(t *testing.T) {
+	history := []provider.Message{
+		{Role: provider.RoleSystem, Content: "system"},
+		{Role: provider.RoleUser, Content: "first question"},
+		{Role: provider.RoleAssistant, Content: "first answer"},
+		{Role: provider.RoleUser, Content: "read it"},
+		toolCall("1", `{"path":"`+strings.Repeat("a", 200)+`"}`),
+		{Role: provider.RoleTool, ToolCallID: "1", Content: "content"},
+		toolCall("2", `{"path":"b"}`),
+		{Role: provider.RoleTool, ToolCallID: "2", Content: strings.Repeat("b", 300)},
+		{Role: provider.RoleAssistant, Content: "done"},
+		{Role: provider.RoleUser, Content: "thanks"},
+	}
+
+	// sizes sums up the size of the messages at indexes
+	sizes := func(indexes ...int) int {
+		n := 0
+		for _, i := range indexes {
+			n += messageSize(history[i])
+		}
+		return n
+	}
+
+	tests := []struct {
+		name   string
+		budget int
+		want   []int
+	}{
+		{"unlimited", 0, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"everything fits", sizes(0, 1, 2, 3, 4, 5, 6, 7, 8, 9), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"latest turn over budget", 1, []int{0, 9}},
+		{"latest turns", sizes(0, 8, 9), []int{0, 9}},
+		{"tool result without its call", sizes(0, 7, 8, 9), []int{0, 9}},
+		{"large tool arguments", sizes(0, 5, 6, 7, 8, 9) + 100, []int{0, 9}},
+		{"tool turn", sizes(0, 3, 4, 5, 6, 7, 8, 9), []int{0, 3, 4, 5, 6, 7, 8, 9}},
+		{"tool turn missing its question", sizes(0, 4, 5, 6, 7, 8, 9), []int{0, 9}},
+		{"one char short", sizes(0, 1, 2, 3, 4, 5, 6, 7, 8, 9) - 1, []int{0, 3, 4, 5, 6, 7, 8, 9}},
+	}
+
+	for _, test := range tests {
+		c := &Conversation{Messages: history, Budget: test.budget}
+
+		var want []provider.Message
+		for _, i := range test.want {
+			want = append(want, history[i])
+		}
+
+		if got := c.Window(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Window() = %v, want %v", test.name, got, want)
+		}
+	}
+}
+
+func TestMessageSize(t *testing.T) {
+	plain := provider.Message{Role: provider.RoleAssistant}
+	call := toolCall("1", `{"path":"`+strings.Repeat("a", 1000)+`"}`)
+	result := provider.Message{Role: provider.RoleTool, ToolCallID: "1", Content: "x"}
+
+	if size := messageSize(call); size < 1000+messageSize(plain) {
+		t.Errorf("messageSize() of tool call = %d, want its arguments counted", size)
+	}
+
+	if size := messageSize(result); size <= len(result.Content)+len(result.ToolCallID) {
+		t.Errorf("messageSize() of tool result = %d, want every field counted", size)
+	}
+}
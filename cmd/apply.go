@@ -0,0 +1,448 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
+)
+
+const (
+	manifestName = "manifest.json"
+	zeroObject   = "0000000000000000000000000000000000000000"
+)
+
+var (
+	applyBranch  string
+	applyDryRun  bool
+	applyForce   bool
+	applyMessage string
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply changes of workspace to repo",
+	Args:  cobra.RangeArgs(1, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		name := args[0]
+		if err := runApply(ctx, config, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(applyCmd)
+
+	applyCmd.Flags().StringVarP(&applyBranch, "branch", "b", "", "commit changes to a new branch instead of the working tree")
+	applyCmd.Flags().BoolVarP(&applyDryRun, "dry-run", "d", false, "show changes without applying them")
+	applyCmd.Flags().BoolVarP(&applyForce, "force", "f", false, "apply even if repo files changed since workspace was created")
+	applyCmd.Flags().StringVarP(&applyMessage, "message", "m", "", "commit message for --branch")
+
+	applyCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <workspace_name> [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git apply your_workspace --dry-run\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git apply your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git apply your_workspace --branch your_branch --message \"your message\"\n")
+		return nil
+	})
+}
+
+func runApply(ctx context.Context, cfg *config.Config, name string) error {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	entry, ok := reg.Get(name)
+	if !ok {
+		return errors.Errorf("workspace %s not found\n", name)
+	}
+
+	if len(entry.LowerDirs) == 0 {
+		return errors.Errorf("workspace %s has no recorded lower directory\n", name)
+	}
+
+	layers, target, err := collectLayers(entry)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		return errors.Errorf("repo of workspace %s not found at %s\n", name, target)
+	}
+
+	changes := mergeLayers(layers, target)
+
+	if len(changes) == 0 {
+		fmt.Printf("no changes to apply in workspace %s\n", name)
+		return nil
+	}
+
+	for _, item := range changes {
+		fmt.Printf("%s\t%s\n", item.Kind, item.Path)
+	}
+
+	since := entry.CreatedAt
+	if entry.AppliedAt.After(since) {
+		since = entry.AppliedAt
+	}
+
+	base, err := overlay.ReadManifest(manifestPath(reg, name))
+	if err != nil {
+		return errors.Wrap(err, "failed to read repo files recorded for workspace\n")
+	}
+
+	if conflicts := overlay.Conflicts(target, changes, base, since); len(conflicts) > 0 && !applyForce {
+		return errors.Errorf("%d file(s) in %s changed since %s, use --force to overwrite:\n  %s\n",
+			len(conflicts), target, since.Local().Format("2006-01-02 15:04:05"), strings.Join(conflicts, "\n  "))
+	}
+
+	if applyDryRun {
+		return nil
+	}
+
+	// The repo is the lower layer of the overlay, which must not change while
+	// it is mounted, and that holds for new objects and branches as well
+	if applyBranch != "" {
+		message := applyMessage
+		if message == "" {
+			message = fmt.Sprintf("Apply workspace %s", name)
+		}
+		var commit string
+		err := withDetachedOverlay(ctx, entry, nil, func() error {
+			var err error
+			commit, err = commitChanges(ctx, target, layers, applyBranch, message)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("committed %d change(s) to branch %s (%s)\n", len(changes), applyBranch, commit[:7])
+		return nil
+	}
+
+	err = withDetachedOverlay(ctx, entry, nil, func() error {
+		for _, layer := range layers {
+			if err := overlay.Apply(layer.dir, target, layer.changes); err != nil {
+				return errors.Wrap(err, "failed to apply changes\n")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	entry.AppliedAt = time.Now()
+
+	// Files just applied are the new base for finding conflicts
+	if err := recordRepo(reg, entry, target); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if err := reg.Put(entry); err != nil {
+		return errors.Wrap(err, "failed to record workspace\n")
+	}
+
+	fmt.Printf("applied %d change(s) to %s\n", len(changes), target)
+
+	return nil
+}
+
+// manifestPath returns where the repo files were recorded when the workspace
+// was created or last applied.
+func manifestPath(reg *registry.Registry, name string) string {
+	return path.Join(reg.StateDir(name), manifestName)
+}
+
+// recordRepo records the files of the repo of a workspace, so apply can tell
+// which of them changed outside of it. Walking a repo mounted over sshfs is
+// too slow, those keep comparing modification times.
+func recordRepo(reg *registry.Registry, entry *registry.Entry, repo string) error {
+	name := manifestPath(reg, entry.Name)
+
+	if entry.Sshfs != "" {
+		_ = os.Remove(name)
+		return nil
+	}
+
+	manifest, err := overlay.NewManifest(repo)
+	if err != nil {
+		return errors.Wrap(err, "failed to record repo files")
+	}
+
+	return overlay.WriteManifest(name, manifest)
+}
+
+// layerChanges are the changes one layer of a workspace makes to the layers
+// below it.
+type layerChanges struct {
+	dir     string
+	changes []overlay.Change
+}
+
+// collectLayers returns the changes of the upper layer and of the layers
+// frozen by fork, ordered bottom to top so they can be replayed in turn, and
+// the repo they apply to, which is the first lower layer not made by fork.
+// Files that come from the extra layers below the repo are left out, so
+// caches stacked with --layer never end up in the repo.
+func collectLayers(entry *registry.Entry) ([]layerChanges, string, error) {
+	dirs := []string{entry.UpperDir}
+	lowers := entry.LowerDirs
+
+	for len(lowers) > 0 && isFrozenDir(entry.Mount, lowers[0]) {
+		dirs = append(dirs, lowers[0])
+		lowers = lowers[1:]
+	}
+
+	if len(lowers) == 0 {
+		return nil, "", errors.Errorf("workspace %s has no recorded lower directory\n", entry.Name)
+	}
+
+	repo, extra := lowers[0], lowers[1:]
+
+	var layers []layerChanges
+	var skipped []string
+
+	seen := map[string]bool{}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		all, err := overlay.Changes(dirs[i], entry.LowerDirs[i:]...)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "failed to collect changes\n")
+		}
+		// Commits made inside the workspace stay there, only files are applied
+		var changes []overlay.Change
+		for _, item := range all {
+			if overlay.InGitDir(item.Path) {
+				continue
+			}
+			if item.Kind != overlay.Deleted && fromLayer(repo, extra, item.Path) {
+				if !seen[item.Path] {
+					seen[item.Path] = true
+					skipped = append(skipped, item.Path)
+				}
+				continue
+			}
+			changes = append(changes, item)
+		}
+		layers = append(layers, layerChanges{dirs[i], changes})
+	}
+
+	if len(skipped) > 0 {
+		sort.Strings(skipped)
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %d file(s) from extra layers are not applied:\n  %s\n",
+			len(skipped), strings.Join(skipped, "\n  "))
+	}
+
+	return layers, repo, nil
+}
+
+// fromLayer reports whether rel, or the closest of its parents that exists
+// below the workspace, is found in one of the extra layers rather than in the
+// repo.
+func fromLayer(repo string, extra []string, rel string) bool {
+	for p := rel; p != "." && p != "/"; p = filepath.Dir(p) {
+		if _, err := os.Lstat(filepath.Join(repo, p)); err == nil {
+			return false
+		}
+		if info, _ := overlay.Lookup(extra, p); info != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeLayers returns the change every path ends up with in target, where
+// upper layers win over the ones below.
+func mergeLayers(layers []layerChanges, target string) []overlay.Change {
+	kinds := map[string]overlay.Kind{}
+
+	for _, layer := range layers {
+		for _, item := range layer.changes {
+			kinds[item.Path] = item.Kind
+		}
+	}
+
+	var changes []overlay.Change
+
+	for p, kind := range kinds {
+		_, err := os.Lstat(filepath.Join(target, p))
+		exists := err == nil
+		switch {
+		case kind == overlay.Deleted && !exists:
+			continue
+		case kind != overlay.Deleted && exists:
+			kind = overlay.Modified
+		case kind != overlay.Deleted:
+			kind = overlay.Added
+		}
+		changes = append(changes, overlay.Change{Path: p, Kind: kind})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+// commitChanges builds a commit on top of HEAD from the workspace layers with
+// git plumbing and a temporary index, so the working tree and the real index
+// of the repo are left untouched.
+func commitChanges(ctx context.Context, repo string, layers []layerChanges, branch, message string) (string, error) {
+	index, err := os.CreateTemp("", "repo-scm-index-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create index\n")
+	}
+
+	_ = index.Close()
+	_ = os.Remove(index.Name())
+
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(index.Name())
+
+	git := func(stdin string, args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+index.Name())
+		if stdin != "" {
+			cmd.Stdin = strings.NewReader(stdin)
+		}
+		output, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return "", errors.Errorf("git %s failed: %s\n", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", errors.Wrapf(err, "git %s failed\n", args[0])
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	if _, err := git("", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		return "", errors.Errorf("branch %s already exists\n", branch)
+	}
+
+	parent, _ := git("", "rev-parse", "--verify", "--quiet", "HEAD")
+
+	if parent != "" {
+		if _, err := git("", "read-tree", parent); err != nil {
+			return "", err
+		}
+	}
+
+	var info strings.Builder
+
+	// Later lines win, so upper layers override the ones below
+	for _, layer := range layers {
+		for _, item := range layer.changes {
+			if item.Kind == overlay.Deleted {
+				fmt.Fprintf(&info, "0 %s\t%s\n", zeroObject, item.Path)
+				continue
+			}
+			mode, object, err := hashObject(git, layer.dir, item.Path)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&info, "%s %s\t%s\n", mode, object, item.Path)
+		}
+	}
+
+	if _, err := git(info.String(), "update-index", "--index-info"); err != nil {
+		return "", err
+	}
+
+	tree, err := git("", "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+
+	commit, err := git("", args...)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := git("", "branch", branch, commit); err != nil {
+		return "", err
+	}
+
+	return commit, nil
+}
+
+func hashObject(git func(stdin string, args ...string) (string, error), upper, rel string) (string, string, error) {
+	name := filepath.Join(upper, rel)
+
+	info, err := os.Lstat(name)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to read %s\n", rel)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(name)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "failed to read %s\n", rel)
+		}
+		object, err := git(link, "hash-object", "-w", "--stdin")
+		return "120000", object, err
+	}
+
+	mode := "100644"
+	if info.Mode().Perm()&0111 != 0 {
+		mode = "100755"
+	}
+
+	// --path applies the attributes and filters git add would use
+	object, err := git("", "hash-object", "-w", "--path", rel, "--", name)
+
+	return mode, object, err
+}
@@ -0,0 +1,248 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
+)
+
+func writeTestFile(t *testing.T, root, name, content string) {
+	t.Helper()
+
+	p := filepath.Join(root, name)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectLayers(t *testing.T) {
+	base := t.TempDir()
+
+	entry := &registry.Entry{
+		Name:  "ws",
+		Mount: filepath.Join(base, "ws"),
+	}
+
+	frozen := frozenDir(entry.Mount)
+	repo := filepath.Join(base, "repo")
+	cache := filepath.Join(base, "cache")
+
+	entry.UpperDir, entry.WorkDir = overlayDirs(entry.Mount)
+	entry.LowerDirs = []string{frozen, repo, cache}
+
+	writeTestFile(t, repo, "README", "readme\n")
+	writeTestFile(t, repo, "src/main.go", "package main\n")
+	writeTestFile(t, repo, "shared", "repo\n")
+	writeTestFile(t, cache, "shared", "cache\n")
+	writeTestFile(t, cache, "cached.txt", "cached\n")
+	writeTestFile(t, cache, "node_modules/pkg/index.js", "cached\n")
+
+	writeTestFile(t, frozen, "node_modules/pkg/index.js", "patched\n")
+	writeTestFile(t, frozen, "src/feature.go", "package main\n")
+
+	writeTestFile(t, entry.UpperDir, ".git/HEAD", "ref: refs/heads/main\n")
+	writeTestFile(t, entry.UpperDir, ".wh.README", "")
+	writeTestFile(t, entry.UpperDir, "cached.txt", "changed\n")
+	writeTestFile(t, entry.UpperDir, "node_modules/new.js", "new\n")
+	writeTestFile(t, entry.UpperDir, "shared", "changed\n")
+	writeTestFile(t, entry.UpperDir, "src/main.go", "package main\n\nfunc main() {}\n")
+	writeTestFile(t, entry.UpperDir, "new", "new\n")
+
+	layers, target, err := collectLayers(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target != repo {
+		t.Errorf("collectLayers() target = %s, want %s", target, repo)
+	}
+
+	want := []layerChanges{
+		{frozen, []overlay.Change{
+			{Path: "src/feature.go", Kind: overlay.Added},
+		}},
+		{entry.UpperDir, []overlay.Change{
+			{Path: "README", Kind: overlay.Deleted},
+			{Path: "new", Kind: overlay.Added},
+			{Path: "shared", Kind: overlay.Modified},
+			{Path: "src/main.go", Kind: overlay.Modified},
+		}},
+	}
+
+	if !reflect.DeepEqual(layers, want) {
+		t.Errorf("collectLayers() = %v, want %v", layers, want)
+	}
+}
+
+func TestMergeLayers(t *testing.T) {
+	target := t.TempDir()
+
+	writeTestFile(t, target, "base", "base\n")
+	writeTestFile(t, target, "edited", "old\n")
+
+	layers := []layerChanges{
+		{"frozen", []overlay.Change{
+			{Path: "tmp", Kind: overlay.Added},
+			{Path: "edited", Kind: overlay.Modified},
+			{Path: "base", Kind: overlay.Deleted},
+			{Path: "readded", Kind: overlay.Added},
+		}},
+		{"upper", []overlay.Change{
+			{Path: "tmp", Kind: overlay.Deleted},
+			{Path: "edited", Kind: overlay.Deleted},
+			{Path: "base", Kind: overlay.Added},
+			{Path: "readded", Kind: overlay.Modified},
+			{Path: "fresh", Kind: overlay.Added},
+		}},
+	}
+
+	want := []overlay.Change{
+		{Path: "base", Kind: overlay.Modified},
+		{Path: "edited", Kind: overlay.Deleted},
+		{Path: "fresh", Kind: overlay.Added},
+		{Path: "readded", Kind: overlay.Added},
+	}
+
+	if got := mergeLayers(layers, target); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeLayers() = %v, want %v", got, want)
+	}
+}
+
+func TestCommitChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	for _, key := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(key+"_NAME", "test")
+		t.Setenv(key+"_EMAIL", "test@example.com")
+	}
+
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("HOME", t.TempDir())
+
+	ctx := context.Background()
+	repo := t.TempDir()
+
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	git("init", "-q")
+
+	writeTestFile(t, repo, "edit", "old\n")
+	writeTestFile(t, repo, "gone", "gone\n")
+	writeTestFile(t, repo, "keep", "keep\n")
+
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	head := git("rev-parse", "HEAD")
+
+	// Uncommitted work in the repo must stay out of the commit and in place
+	writeTestFile(t, repo, "keep", "dirty\n")
+	git("add", "keep")
+	status := git("status", "--porcelain")
+
+	frozen := t.TempDir()
+	upper := t.TempDir()
+
+	writeTestFile(t, frozen, "edit", "frozen\n")
+	writeTestFile(t, frozen, "dir/file", "file\n")
+	writeTestFile(t, upper, "edit", "new\n")
+	writeTestFile(t, upper, "tool", "#!/bin/sh\n")
+
+	if err := os.Chmod(filepath.Join(upper, "tool"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("edit", filepath.Join(upper, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	layers := []layerChanges{
+		{frozen, []overlay.Change{
+			{Path: "edit", Kind: overlay.Modified},
+			{Path: "dir/file", Kind: overlay.Added},
+		}},
+		{upper, []overlay.Change{
+			{Path: "edit", Kind: overlay.Modified},
+			{Path: "gone", Kind: overlay.Deleted},
+			{Path: "link", Kind: overlay.Added},
+			{Path: "tool", Kind: overlay.Added},
+		}},
+	}
+
+	commit, err := commitChanges(ctx, repo, layers, "workspace", "Apply workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := git("rev-parse", "workspace"); got != commit {
+		t.Errorf("branch points to %s, want %s", got, commit)
+	}
+
+	if got := git("rev-parse", "workspace^"); got != head {
+		t.Errorf("parent of commit is %s, want %s", got, head)
+	}
+
+	if got := git("log", "-1", "--format=%s", "workspace"); got != "Apply workspace" {
+		t.Errorf("commit message is %q", got)
+	}
+
+	want := strings.Join([]string{
+		"100644 dir/file",
+		"100644 edit",
+		"100644 keep",
+		"120000 link",
+		"100755 tool",
+	}, "\n")
+
+	var tree []string
+	for _, line := range strings.Split(git("ls-tree", "-r", "workspace"), "\n") {
+		fields := strings.Fields(line)
+		tree = append(tree, fields[0]+" "+fields[3])
+	}
+
+	if got := strings.Join(tree, "\n"); got != want {
+		t.Errorf("tree of commit is\n%s\nwant\n%s", got, want)
+	}
+
+	for name, content := range map[string]string{"edit": "new", "keep": "keep", "link": "edit", "dir/file": "file"} {
+		if got := git("show", "workspace:"+name); got != content {
+			t.Errorf("%s in commit is %q, want %q", name, got, content)
+		}
+	}
+
+	if got := git("rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved to %s", got)
+	}
+
+	if got := git("status", "--porcelain"); got != status {
+		t.Errorf("status changed to %q, want %q", got, status)
+	}
+
+	if _, err := commitChanges(ctx, repo, layers, "workspace", "again"); err == nil {
+		t.Error("commitChanges to existing branch succeeded, want error")
+	}
+}
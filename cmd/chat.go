@@ -7,13 +7,19 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	"github.com/repo-scm/git/chat"
 	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/provider"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/sandbox"
 )
 
 const (
@@ -26,22 +32,35 @@ const (
 	chatHelp = `
 💡 Available commands:
 
-help   - Show this help message
-clear  - Clear the screen
-models - Show all models
-model  - Show current model
-exit   - Exit the chat session
+help     - Show this help message
+clear    - Clear the screen
+models   - Show all models
+model    - Show current model
+history  - Show current session
+sessions - Show saved sessions
+reset    - Forget the conversation so far
+exit     - Exit the chat session
+
+/add <path>  - Attach a file or directory to the context
+/drop <path> - Detach a file or directory from the context
+/files       - Show attached files
+/context     - Show the context sent with each message
 `
 
 	chatBye = `
 👋 Thanks for using Git Chat!
 🏁 Done!
 `
+
+	chatSystem = "You are a helpful coding assistant working in the git workspace %q. " +
+		"Use the provided tools to read and edit files and to run commands in the workspace."
 )
 
 var (
-	modelID   string
-	quietMode bool
+	modelID     string
+	quietMode   bool
+	resumeName  string
+	autoApprove bool
 )
 
 var chatCmd = &cobra.Command{
@@ -73,6 +92,8 @@ func init() {
 
 	chatCmd.PersistentFlags().StringVarP(&modelID, "model", "m", "litellm/anthropic/claude-opus-4-20250514", "model name")
 	chatCmd.PersistentFlags().BoolVarP(&quietMode, "quiet", "q", false, "quiet mode")
+	chatCmd.PersistentFlags().StringVarP(&resumeName, "resume", "r", "", "resume chat session")
+	chatCmd.PersistentFlags().BoolVarP(&autoApprove, "auto-approve", "y", false, "run tools without confirmation")
 
 	chatCmd.SetUsageFunc(func(cmd *cobra.Command) error {
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
@@ -100,6 +121,8 @@ func init() {
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git chat your_workspace your_prompt --model provider_name/model_id\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git chat your_workspace your_prompt --model provider_name/model_id --quiet\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git chat your_workspace --resume your_session\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git chat your_workspace your_prompt --quiet --auto-approve\n")
 		return nil
 	})
 }
@@ -115,18 +138,121 @@ func runChat(ctx context.Context, cfg *config.Config, name, prompt string) error
 		return errors.Wrap(err, "failed to select model\n")
 	}
 
-	fmt.Printf(chatWelcome, name, fmt.Sprintf("%s/%s", model.ProviderName, model.ModelId))
+	llm, err := provider.New(model)
+	if err != nil {
+		return err
+	}
+
+	conv, err := openConversation(cfg, name, resumeName)
+	if err != nil {
+		return err
+	}
+
+	conv.Model = fmt.Sprintf("%s/%s", model.ProviderName, model.ModelId)
+
+	builder, err := newContextBuilder(cfg, name)
+	if err != nil {
+		return err
+	}
+
+	session := &chatSession{
+		model:    model,
+		provider: llm,
+		conv:     conv,
+		builder:  builder,
+		input:    bufio.NewScanner(os.Stdin),
+	}
+
+	session.agent = chat.NewAgent(builder.Root, func(call provider.ToolCall) bool {
+		return confirmToolCall(session, call)
+	})
+
+	// Commands of the model can only be kept inside the workspace by a sandbox
+	if err := sandbox.Available(); err == nil {
+		session.agent.Sandbox()
+	} else if autoApprove {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %v, run_command still asks for confirmation\n", err)
+	}
+
+	fmt.Printf(chatWelcome, name, conv.Model)
 
 	if quietMode {
-		return sendMessage(ctx, model, prompt)
+		return sendMessage(ctx, session, prompt)
 	}
 
 	fmt.Println()
+	fmt.Printf("Session: %s (%d messages)\n", conv.ID, conv.Turns())
 	fmt.Println("Type 'help' for available commands")
 	fmt.Println("Type 'exit' to end the session")
 	fmt.Println()
 
-	return startInteractiveChat(ctx, model)
+	if prompt != "" {
+		if err := sendMessage(ctx, session, prompt); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+
+	return startInteractiveChat(ctx, session)
+}
+
+type chatSession struct {
+	model    config.Model
+	provider provider.Provider
+	conv     *chat.Conversation
+	builder  *chat.ContextBuilder
+	agent    *chat.Agent
+	input    *bufio.Scanner
+}
+
+// newContextBuilder ties the chat to the workspace mount, diffing its upper
+// layer against the recorded lower layers.
+func newContextBuilder(cfg *config.Config, name string) (*chat.ContextBuilder, error) {
+	entry, _, err := LookupWorkspace(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(entry.Mount); err != nil || !info.IsDir() {
+		return nil, errors.Errorf("workspace %s not found at %s\n", name, entry.Mount)
+	}
+
+	builder := chat.NewContextBuilder(entry.Mount, entry.UpperDir, entry.LowerDirs)
+	if cfg.Chat.ContextBudget > 0 {
+		builder.Budget = cfg.Chat.ContextBudget
+	}
+
+	return builder, nil
+}
+
+// openConversation resumes a saved session or starts a new one. Sessions are
+// kept per workspace so each overlay has its own history.
+func openConversation(cfg *config.Config, name, session string) (*chat.Conversation, error) {
+	reg, err := registry.Open("")
+	if err != nil {
+		return nil, err
+	}
+
+	dir := sessionsDir(reg, name)
+
+	var conv *chat.Conversation
+
+	if session != "" {
+		if conv, err = chat.LoadConversation(dir, session); err != nil {
+			return nil, err
+		}
+	} else {
+		conv = chat.NewConversation(dir, name, fmt.Sprintf(chatSystem, name))
+	}
+
+	if cfg.Chat.HistoryBudget > 0 {
+		conv.Budget = cfg.Chat.HistoryBudget
+	}
+
+	return conv, nil
+}
+
+func sessionsDir(reg *registry.Registry, name string) string {
+	return path.Join(reg.StateDir(name), "sessions")
 }
 
 func selectModel(_ context.Context, models []config.Model, name string) (config.Model, error) {
@@ -166,8 +292,9 @@ func selectModel(_ context.Context, models []config.Model, name string) (config.
 	return config.Model{}, errors.New("invalid selection\n")
 }
 
-func startInteractiveChat(ctx context.Context, model config.Model) error {
-	scanner := bufio.NewScanner(os.Stdin)
+func startInteractiveChat(ctx context.Context, session *chatSession) error {
+	conv := session.conv
+	scanner := session.input
 
 	for {
 		fmt.Print("> ")
@@ -178,6 +305,10 @@ func startInteractiveChat(ctx context.Context, model config.Model) error {
 		if input == "" {
 			continue
 		}
+		if strings.HasPrefix(input, "/") {
+			runSlashCommand(ctx, session, input)
+			continue
+		}
 		switch strings.ToLower(input) {
 		case "help":
 			showHelp()
@@ -189,44 +320,190 @@ func startInteractiveChat(ctx context.Context, model config.Model) error {
 			fmt.Printf("TBD\n")
 			continue
 		case "model":
-			fmt.Printf("Current model: %s\n", model)
+			fmt.Printf("Current model: %s\n", session.model)
+			continue
+		case "history":
+			fmt.Printf("Session: %s (%d messages)\n", conv.ID, conv.Turns())
+			continue
+		case "sessions":
+			showSessions(conv)
+			continue
+		case "reset":
+			conv.Reset()
+			_ = conv.Save()
+			fmt.Printf("Conversation reset\n")
 			continue
 		case "exit":
 			fmt.Print(chatBye)
 			return nil
 		}
-		if err := sendMessage(ctx, model, input); err != nil {
-			return err
+		if err := sendMessage(ctx, session, input); err != nil {
+			// Keep the session alive so a transient failure can be retried
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
 		}
 	}
 
 	return nil
 }
 
-func sendMessage(_ context.Context, model config.Model, message string) error {
-	apiBase := model.ApiBase
-	if apiBase == "" {
-		return errors.New("no api base found\n")
-	}
+func runSlashCommand(ctx context.Context, session *chatSession, input string) {
+	command, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
 
-	apiKey := model.ApiKey
-	if apiKey == "" {
-		return errors.New("no api key found\n")
+	switch command {
+	case "/add":
+		if arg == "" {
+			fmt.Printf("Usage: /add <path>\n")
+			return
+		}
+		added, err := session.builder.Add(ctx, arg)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		for _, item := range added {
+			fmt.Printf("Added %s\n", item)
+		}
+	case "/drop":
+		if arg == "" {
+			fmt.Printf("Usage: /drop <path>\n")
+			return
+		}
+		for _, item := range session.builder.Drop(arg) {
+			fmt.Printf("Dropped %s\n", item)
+		}
+	case "/files":
+		for _, item := range session.builder.Files() {
+			fmt.Println(item)
+		}
+	case "/context":
+		text, err := session.builder.Build(ctx)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		fmt.Println(text)
+	default:
+		fmt.Printf("Unknown command: %s\n", command)
 	}
+}
+
+func sendMessage(ctx context.Context, session *chatSession, message string) error {
+	conv := session.conv
+
+	// Ctrl-C aborts the current reply instead of killing the session
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	conv.Add(provider.RoleUser, message)
 
 	fmt.Println()
-	fmt.Printf("Send: %s\n", message)
-	fmt.Println()
-	fmt.Printf("Reply: hello world!\n")
+
+	for step := 0; step < chat.MaxToolSteps; step++ {
+		// Rebuilt every step since tools may have changed the workspace
+		text, err := session.builder.Build(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to build workspace context\n")
+		}
+
+		reply, err := session.provider.Stream(ctx, chat.Inject(conv.Window(), text), session.agent.Specs(), os.Stdout)
+		if err != nil {
+			if step == 0 {
+				conv.Pop()
+			}
+			if ctx.Err() != nil {
+				fmt.Printf("\n\nReply cancelled\n")
+				return conv.Save()
+			}
+			fmt.Println()
+			return err
+		}
+
+		conv.Append(reply)
+
+		if reply.Content != "" {
+			fmt.Printf("\n\n")
+		}
+
+		for _, call := range reply.ToolCalls {
+			fmt.Printf("🔧 %s %s\n", call.Function.Name, summarizeArgs(call.Function.Arguments))
+			result := session.agent.Run(ctx, call)
+			fmt.Printf("%s\n\n", summarizeOutput(result.Content))
+			conv.Append(result)
+		}
+
+		if err := conv.Save(); err != nil {
+			return errors.Wrap(err, "failed to save session\n")
+		}
+
+		if len(reply.ToolCalls) == 0 {
+			return nil
+		}
+	}
+
+	fmt.Printf("Stopped after %d tool steps\n", chat.MaxToolSteps)
 
 	return nil
 }
 
+// confirmToolCall asks before a tool changes the workspace, unless running
+// with --auto-approve. Commands run outside a sandbox can change anything the
+// user can, so they are asked for anyway.
+func confirmToolCall(session *chatSession, call provider.ToolCall) bool {
+	if autoApprove && (call.Function.Name != "run_command" || session.agent.Sandboxed) {
+		return true
+	}
+
+	fmt.Printf("Allow %s %s? [y/N] ", call.Function.Name, call.Function.Arguments)
+
+	if !session.input.Scan() {
+		fmt.Println()
+		return false
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(session.input.Text()))
+
+	return answer == "y" || answer == "yes"
+}
+
+func summarizeArgs(args string) string {
+	if len(args) > 200 {
+		return args[:200] + "..."
+	}
+
+	return args
+}
+
+func summarizeOutput(output string) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > 10 {
+		lines = append(lines[:10], fmt.Sprintf("... (%d more lines)", len(lines)-10))
+	}
+
+	return "   " + strings.Join(lines, "\n   ")
+}
+
 func showHelp() {
 	fmt.Print(chatHelp)
 	fmt.Println()
 }
 
+func showSessions(conv *chat.Conversation) {
+	list, err := chat.ListConversations(conv.Dir())
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		return
+	}
+
+	for _, item := range list {
+		current := " "
+		if item.ID == conv.ID {
+			current = "*"
+		}
+		fmt.Printf("%s %s  %s  %d messages\n", current, item.ID, item.UpdatedAt.Local().Format("2006-01-02 15:04:05"), item.Turns())
+	}
+}
+
 func clearScreen() {
 	fmt.Print("\033[2J\033[H")
 }
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -20,11 +21,14 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
 	"github.com/repo-scm/git/utils"
 )
 
 var (
-	createName string
+	createLayers []string
+	createName   string
 
 	sshfsOptions = []string{
 		"allow_other",
@@ -65,6 +69,7 @@ var createCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(createCmd)
 
+	createCmd.PersistentFlags().StringArrayVarP(&createLayers, "layer", "l", nil, "extra lower layer below repo (repeatable)")
 	createCmd.PersistentFlags().StringVarP(&createName, "name", "n", "", "workspace name")
 
 	createCmd.SetUsageFunc(func(cmd *cobra.Command) error {
@@ -93,6 +98,7 @@ func init() {
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git create /local/repo --name your_workspace\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git create user@host:/remote/repo --name your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git create /local/repo --layer /path/to/cache --layer /path/to/deps\n")
 		return nil
 	})
 }
@@ -114,6 +120,20 @@ func runCreate(ctx context.Context, cfg *config.Config, repo, name string) error
 	sshfsPath := path.Join(utils.ExpandTilde(cfg.Sshfs.Mount), name)
 	overlayPath := path.Join(utils.ExpandTilde(cfg.Overlay.Mount), name)
 
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	if _, ok := reg.Get(name); ok {
+		return errors.Errorf("workspace %s already exists\n", name)
+	}
+
+	layers, err := lowerLayers(append(createLayers, cfg.Overlay.Layers...))
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -127,12 +147,20 @@ func runCreate(ctx context.Context, cfg *config.Config, repo, name string) error
 
 	user, host, _ := utils.ParsePath(ctx, repoPath)
 
+	entry := &registry.Entry{
+		Name:   name,
+		Source: repoPath,
+		Mount:  overlayPath,
+	}
+
 	if user != "" && host != "" {
 		var mounted bool
 		var err error
 		for _, port := range cfg.Sshfs.Ports {
 			if err = MountSshfs(ctx, repoPath, sshfsPath, port); err == nil {
 				mounted = true
+				entry.Sshfs = sshfsPath
+				entry.Port = port
 				break
 			} else {
 				_ = UnmountSshfs(ctx, sshfsPath)
@@ -142,16 +170,90 @@ func runCreate(ctx context.Context, cfg *config.Config, repo, name string) error
 			return err
 		}
 		repoPath = sshfsPath
+	} else if absPath, err := filepath.Abs(repoPath); err == nil {
+		repoPath = absPath
+		entry.Source = absPath
 	}
 
-	if err := MountOverlay(ctx, repoPath, overlayPath); err != nil {
+	entry.LowerDirs = append([]string{path.Clean(repoPath)}, layers...)
+	entry.UpperDir, entry.WorkDir = overlayDirs(overlayPath)
+
+	backend, err := MountOverlay(ctx, cfg.Overlay.Backend, entry.LowerDirs, overlayPath)
+	if err != nil {
 		_ = UnmountSshfs(ctx, sshfsPath)
 		return err
 	}
 
+	entry.Backend = backend
+
+	if err := recordRepo(reg, entry, repoPath); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %v, apply falls back to modification times\n", err)
+	}
+
+	if err := reg.Put(entry); err != nil {
+		_ = UnmountOverlay(ctx, overlayPath)
+		_ = UnmountSshfs(ctx, sshfsPath)
+		return errors.Wrap(err, "failed to record workspace\n")
+	}
+
 	return nil
 }
 
+// lowerLayers resolves the extra layers stacked below the repo, in order and
+// without repeats.
+func lowerLayers(names []string) ([]string, error) {
+	var layers []string
+
+	seen := map[string]bool{}
+
+	for _, item := range names {
+		layer, err := filepath.Abs(utils.ExpandTilde(item))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid layer %s\n", item)
+		}
+		if strings.ContainsAny(layer, ":,") {
+			return nil, errors.Errorf("layer %s must not contain ':' or ','\n", item)
+		}
+		if info, err := os.Stat(layer); err != nil || !info.IsDir() {
+			return nil, errors.Errorf("layer %s is not a directory\n", item)
+		}
+		if !seen[layer] {
+			seen[layer] = true
+			layers = append(layers, layer)
+		}
+	}
+
+	return layers, nil
+}
+
+// mountWorkspace mounts the overlay of a recorded workspace again, reusing its
+// upper and work directories.
+func mountWorkspace(ctx context.Context, entry *registry.Entry) error {
+	if len(entry.LowerDirs) == 0 {
+		return errors.Errorf("workspace %s has no recorded lower directory\n", entry.Name)
+	}
+
+	// The upper layer format follows the backend it was created with
+	_, err := MountOverlay(ctx, entry.Backend, entry.LowerDirs, entry.Mount)
+
+	return err
+}
+
+// frozenDir returns the directory next to an overlay mount holding the copy of
+// the upper layer a workspace was forked from, as lower-<name>.
+func frozenDir(mount string) string {
+	return path.Join(path.Dir(path.Clean(mount)), "lower-"+path.Base(path.Clean(mount)))
+}
+
+// overlayDirs returns the upper and work directories that live next to an
+// overlay mount as upper-<name> and work-<name>.
+func overlayDirs(mount string) (upper, work string) {
+	mountDir := path.Dir(path.Clean(mount))
+	mountName := path.Base(path.Clean(mount))
+
+	return path.Join(mountDir, "upper-"+mountName), path.Join(mountDir, "work-"+mountName)
+}
+
 func getSshfsOptions() []string {
 	// Check SSHFS version to determine compatible options
 	cmd := exec.Command("sshfs", "--version")
@@ -266,27 +368,59 @@ func MountSshfs(ctx context.Context, repo, mount string, port int) error {
 	return nil
 }
 
-func MountOverlay(_ context.Context, repo, mount string) error {
-	if repo == "" || mount == "" {
-		return errors.New("repo and mount are required\n")
+// MountOverlay mounts lowers, ordered top to bottom, at mount with the upper
+// and work directories next to it, and returns the backend that mounted it.
+func MountOverlay(_ context.Context, backend string, lowers []string, mount string) (string, error) {
+	if len(lowers) == 0 || mount == "" {
+		return "", errors.New("repo and mount are required\n")
 	}
 
-	// Ensure parent directories exist with proper permissions
-	if err := ensureMountDirectories(mount); err != nil {
-		return errors.New("failed to create directory\n")
+	var lowerDirs []string
+
+	for _, item := range lowers {
+		if item == "" {
+			return "", errors.New("repo and mount are required\n")
+		}
+		lowerDirs = append(lowerDirs, path.Clean(item))
+	}
+
+	driver, err := overlay.NewBackend(backend)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid overlay backend\n")
 	}
 
 	mountDir := path.Dir(path.Clean(mount))
-	mountName := path.Base(path.Clean(mount))
+	upperPath, workPath := overlayDirs(mount)
+
+	opts := overlay.Options{
+		Lowers: lowerDirs,
+		Upper:  upperPath,
+		Work:   workPath,
+		Target: path.Clean(mount),
+	}
+
+	// No backend can mount such paths, so nothing is made for them
+	if err := opts.Validate(); err != nil {
+		return "", errors.Wrap(err, "failed to mount overlay\n")
+	}
 
-	upperPath := path.Join(mountDir, "upper-"+mountName)
-	workPath := path.Join(mountDir, "work-"+mountName)
+	// Ensure parent directories exist with proper permissions
+	if err := ensureMountDirectories(mount); err != nil {
+		return "", errors.New("failed to create directory\n")
+	}
 
 	dirs := []string{mount, upperPath, workPath}
 
+	// Only directories made here are cleaned up on failure, a remount must
+	// never lose the upper layer of an existing workspace
+	var created []string
+
 	for _, item := range dirs {
+		if _, err := os.Stat(item); os.IsNotExist(err) {
+			created = append(created, item)
+		}
 		if err := os.MkdirAll(item, 0755); err != nil {
-			return errors.Wrap(err, "failed to make directory\n")
+			return "", errors.Wrap(err, "failed to make directory\n")
 		}
 		_ = os.Chown(item, os.Getuid(), os.Getgid())
 		_ = os.Chmod(item, utils.PermDir)
@@ -295,28 +429,29 @@ func MountOverlay(_ context.Context, repo, mount string) error {
 	// Test write access to upper directory before mounting
 	testFile := path.Join(upperPath, ".write_test")
 	if err := os.WriteFile(testFile, []byte("test"), utils.PermFile); err != nil {
-		return errors.Wrap(err, "failed to write test file to upper directory - check permissions\n")
+		return "", errors.Wrap(err, "failed to write test file to upper directory - check permissions\n")
 	}
 	_ = os.Remove(testFile)
 
-	cmd := exec.Command("fuse-overlayfs",
-		"-o", fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", path.Clean(repo), upperPath, workPath),
-		path.Clean(mount),
-	)
+	err = driver.Mount(opts)
+	if err != nil && backend == overlay.BackendAuto && driver.Name() != overlay.BackendFuse {
+		fmt.Printf("Warning: %v, falling back to fuse-overlayfs\n", err)
+		driver = overlay.Fuse{}
+		err = driver.Mount(opts)
+	}
 
-	if err := cmd.Run(); err != nil {
-		dirsToRemove := []string{mount, upperPath, workPath}
-		for _, dir := range dirsToRemove {
+	if err != nil {
+		for _, dir := range created {
 			if dir != mountDir {
 				if removeErr := os.RemoveAll(dir); removeErr != nil {
 					fmt.Printf("Warning: failed to clean up directory %s: %v\n", dir, removeErr)
 				}
 			}
 		}
-		return errors.Wrap(err, "failed to mount overlay with fuse-overlayfs\n")
+		return "", errors.Wrap(err, "failed to mount overlay\n")
 	}
 
-	fmt.Printf("successfully mounted overlay at %s\n", mount)
+	fmt.Printf("successfully mounted overlay at %s with %s backend\n", mount, driver.Name())
 
-	return nil
+	return driver.Name(), nil
 }
@@ -7,15 +7,17 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
 	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/registry"
 	"github.com/repo-scm/git/utils"
 )
 
@@ -93,24 +95,13 @@ func runDelete(ctx context.Context, cfg *config.Config, name string) error {
 		cancel()
 	}()
 
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
 	if name != "" {
-		sshfsPath := path.Join(utils.ExpandTilde(cfg.Sshfs.Mount), name)
-		overlayPath := path.Join(utils.ExpandTilde(cfg.Overlay.Mount), name)
-		if err := UnmountOverlay(ctx, overlayPath); err != nil {
-			if ctx.Err() != nil {
-				fmt.Println("Operation cancelled")
-				return ctx.Err()
-			}
-			fmt.Println(err.Error())
-		}
-		if err := UnmountSshfs(ctx, sshfsPath); err != nil {
-			if ctx.Err() != nil {
-				fmt.Println("Operation cancelled")
-				return ctx.Err()
-			}
-			fmt.Println(err.Error())
-		}
-		return nil
+		return deleteWorkspace(ctx, cfg, reg, name)
 	}
 
 	workspaces, err := QueryWorkspaces(ctx, cfg, false)
@@ -126,20 +117,59 @@ func runDelete(ctx context.Context, cfg *config.Config, name string) error {
 		default:
 		}
 
-		sshfsPath := path.Join(utils.ExpandTilde(cfg.Sshfs.Mount), item.Name)
-		overlayPath := path.Join(utils.ExpandTilde(cfg.Overlay.Mount), item.Name)
-		if err := UnmountOverlay(ctx, overlayPath); err != nil {
+		if err := deleteWorkspace(ctx, cfg, reg, item.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deleteWorkspace(ctx context.Context, cfg *config.Config, reg *registry.Registry, name string) error {
+	sshfsPath := path.Join(utils.ExpandTilde(cfg.Sshfs.Mount), name)
+	overlayPath := path.Join(utils.ExpandTilde(cfg.Overlay.Mount), name)
+
+	entry, registered := reg.Get(name)
+	if registered {
+		overlayPath = entry.Mount
+		if entry.Sshfs != "" {
+			sshfsPath = entry.Sshfs
+		}
+	}
+
+	overlayErr := UnmountOverlay(ctx, overlayPath)
+	if overlayErr != nil {
+		if ctx.Err() != nil {
+			fmt.Println("Operation cancelled")
+			return ctx.Err()
+		}
+		fmt.Println(overlayErr.Error())
+	}
+
+	// Forks share the sshfs mount and frozen layers of the workspace they came from
+	shared := sharedPaths(reg, name)
+
+	if !shared[path.Clean(sshfsPath)] {
+		if err := UnmountSshfs(ctx, sshfsPath); err != nil {
 			if ctx.Err() != nil {
 				fmt.Println("Operation cancelled")
 				return ctx.Err()
 			}
 			fmt.Println(err.Error())
 		}
-		if err := UnmountSshfs(ctx, sshfsPath); err != nil {
-			if ctx.Err() != nil {
-				fmt.Println("Operation cancelled")
-				return ctx.Err()
+	}
+
+	// Keep the record while the overlay is still around so delete can be retried
+	if registered && overlayErr == nil {
+		for _, item := range entry.LowerDirs {
+			if shared[path.Clean(item)] || !isFrozenDir(overlayPath, item) {
+				continue
 			}
+			if err := removeDir(item); err != nil {
+				fmt.Println(err.Error())
+			}
+		}
+		if err := reg.Remove(name); err != nil {
 			fmt.Println(err.Error())
 		}
 	}
@@ -147,107 +177,115 @@ func runDelete(ctx context.Context, cfg *config.Config, name string) error {
 	return nil
 }
 
-func UnmountOverlay(ctx context.Context, mount string) error {
-	if mount == "" {
-		return fmt.Errorf("mount is empty")
-	}
+// sharedPaths returns the sshfs mounts and lower layers used by workspaces
+// other than name.
+func sharedPaths(reg *registry.Registry, name string) map[string]bool {
+	shared := map[string]bool{}
 
-	mountDir := path.Dir(path.Clean(mount))
-	mountName := path.Base(path.Clean(mount))
-
-	upperPath := path.Join(mountDir, "upper-"+mountName)
-	workPath := path.Join(mountDir, "work-"+mountName)
-
-	// Try normal unmount first
-	cmd := exec.CommandContext(ctx, "fusermount", "-u", path.Clean(mount))
-	if err := cmd.Run(); err != nil {
-		// Try forced unmount if normal fails
-		forceCmd := exec.CommandContext(ctx, "fusermount", "-uz", path.Clean(mount))
-		forceErr := forceCmd.Run()
-		if forceErr != nil {
-			// Try lazy umount as last resort
-			lazyCmd := exec.CommandContext(ctx, "umount", "-l", path.Clean(mount))
-			lazyErr := lazyCmd.Run()
-			if lazyErr != nil {
-				return fmt.Errorf("all unmount attempts failed for %s: %v, %v, %v", mount, err, forceErr, lazyErr)
-			}
+	for _, item := range reg.List() {
+		if item.Name == name {
+			continue
+		}
+		if item.Sshfs != "" {
+			shared[path.Clean(item.Sshfs)] = true
+		}
+		for _, lower := range item.LowerDirs {
+			shared[path.Clean(lower)] = true
 		}
 	}
 
-	fmt.Printf("successfully unmounted overlay\n")
+	return shared
+}
 
-	// Remove mount, work, and upper dirs using rm -rf for better symlink handling
-	var removeErrs []error
+// isFrozenDir reports whether lower is a layer created by fork next to the
+// overlay mounts, as opposed to a repo or a user supplied layer.
+func isFrozenDir(mount, lower string) bool {
+	return path.Dir(path.Clean(lower)) == path.Dir(path.Clean(mount)) && strings.HasPrefix(path.Base(lower), "lower-")
+}
 
-	// Use rm -rf command for more robust removal, especially with symlinks and permission issues
-	dirsToRemove := []string{mount, workPath, upperPath}
-	for _, dir := range dirsToRemove {
-		if _, err := os.Stat(dir); os.IsNotExist(err) {
-			continue // Skip if directory doesn't exist
-		}
+func removeDir(dir string) error {
+	if err := mount.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove dir %s: %w", dir, err)
+	}
 
-		// Try to fix permissions first before removal
-		if fixErr := exec.Command("chmod", "-R", "u+w", dir).Run(); fixErr != nil {
-			fmt.Printf("Warning: failed to fix permissions for %s: %v\n", dir, fixErr)
-		}
+	return nil
+}
 
-		// First try Go's os.RemoveAll
-		if rmErr := os.RemoveAll(dir); rmErr != nil {
-			// If Go's RemoveAll fails, use rm -rf which handles permissions better
-			rmCmd := exec.CommandContext(ctx, "rm", "-rf", dir)
-			if rmCmdErr := rmCmd.Run(); rmCmdErr != nil {
-				// Final attempt with sudo if available
-				sudoCmd := exec.CommandContext(ctx, "sudo", "rm", "-rf", dir)
-				if sudoCmdErr := sudoCmd.Run(); sudoCmdErr != nil {
-					removeErrs = append(removeErrs, fmt.Errorf("failed to remove dir %s: go error: %v, rm error: %v, sudo error: %v", dir, rmErr, rmCmdErr, sudoCmdErr))
-				}
-			}
+func UnmountOverlay(ctx context.Context, target string) error {
+	if target == "" {
+		return fmt.Errorf("mount is empty")
+	}
+
+	mountName := path.Base(path.Clean(target))
+	upperPath, workPath := overlayDirs(target)
+
+	if err := DetachOverlay(ctx, target); err != nil {
+		return err
+	}
+
+	var removeErrs []error
+
+	for _, dir := range []string{target, workPath, upperPath} {
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err := mount.RemoveAll(dir); err != nil {
+			removeErrs = append(removeErrs, err)
 		}
 	}
 
 	if len(removeErrs) > 0 {
-		return fmt.Errorf("cleanup errors occurred for workspace %s", mountName)
+		return fmt.Errorf("cleanup errors occurred for workspace %s: %w", mountName, errors.Join(removeErrs...))
 	}
 
 	return nil
 }
 
-func UnmountSshfs(ctx context.Context, mount string) error {
-	if mount == "" {
-		return fmt.Errorf("mount is required")
+// DetachOverlay unmounts the overlay but keeps its mount, upper and work
+// directories, so it can be mounted again with the same state.
+func DetachOverlay(ctx context.Context, target string) error {
+	if target == "" {
+		return fmt.Errorf("mount is empty")
+	}
+
+	mounted, err := mount.IsMounted(target)
+	if err != nil {
+		return err
 	}
 
-	// Check if mount point exists and is actually mounted
-	if _, err := os.Stat(mount); os.IsNotExist(err) {
+	if !mounted {
 		return nil
 	}
 
-	cmd := exec.CommandContext(ctx, "fusermount", "-u", path.Clean(mount))
+	if err := mount.Unmount(ctx, target); err != nil {
+		return fmt.Errorf("failed to unmount overlay: %w", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		// Check if the error is because nothing is mounted
-		var exitError *exec.ExitError
-		if errors.As(err, &exitError) {
-			if exitError.ExitCode() == 1 {
-				return nil
-			}
-		}
-		fmt.Println(err.Error())
-		return nil
+	fmt.Printf("successfully unmounted overlay\n")
+
+	return nil
+}
+
+func UnmountSshfs(ctx context.Context, target string) error {
+	if target == "" {
+		return fmt.Errorf("mount is required")
 	}
 
-	fmt.Printf("successfully unmounted sshfs\n")
+	mounted, err := mount.IsMounted(target)
+	if err != nil {
+		return err
+	}
 
-	// Remove mount directory using rm -rf for better symlink handling
-	if rmErr := os.RemoveAll(mount); rmErr != nil {
-		// If Go's RemoveAll fails, use rm -rf which handles symlinks better
-		rmCmd := exec.CommandContext(ctx, "rm", "-rf", mount)
-		if rmCmdErr := rmCmd.Run(); rmCmdErr != nil {
-			fmt.Printf("Warning: failed to remove sshfs mount dir %s: go error: %v, rm error: %v\n", mount, rmErr, rmCmdErr)
+	if mounted {
+		if err := mount.Unmount(ctx, target); err != nil {
+			return fmt.Errorf("failed to unmount sshfs: %w", err)
 		}
+		fmt.Printf("successfully unmounted sshfs\n")
+	}
+
+	// Only the empty mount point is left, the remote files are never touched
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove sshfs mount dir %s: %v\n", target, err)
 	}
 
 	return nil
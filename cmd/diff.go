@@ -0,0 +1,124 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/utils"
+)
+
+var (
+	diffNameStatus bool
+	diffOutput     string
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show changes of workspace",
+	Args:  cobra.RangeArgs(1, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		name := args[0]
+		if err := runDiff(ctx, config, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().BoolVarP(&diffNameStatus, "name-status", "n", false, "show only names and status of changed files")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "write patch to file instead of stdout")
+
+	diffCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <workspace_name> [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git diff your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git diff your_workspace --name-status\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git diff your_workspace --output your_workspace.patch\n")
+		return nil
+	})
+}
+
+func runDiff(_ context.Context, cfg *config.Config, name string) error {
+	entry, _, err := LookupWorkspace(cfg, name)
+	if err != nil {
+		return err
+	}
+
+	if len(entry.LowerDirs) == 0 {
+		return errors.Errorf("workspace %s has no recorded lower directory\n", name)
+	}
+
+	if _, err := os.Stat(entry.UpperDir); err != nil {
+		return errors.Errorf("workspace %s has no upper directory at %s\n", name, entry.UpperDir)
+	}
+
+	changes, err := overlay.Changes(entry.UpperDir, entry.LowerDirs...)
+	if err != nil {
+		return errors.Wrap(err, "failed to collect changes\n")
+	}
+
+	// Git data of commits made inside the workspace is no patch to apply
+	changes = overlay.WithoutGitDir(changes)
+
+	var w io.Writer = os.Stdout
+
+	if diffOutput != "" {
+		file, err := os.OpenFile(filepath.Clean(diffOutput), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, utils.PermFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to create output file\n")
+		}
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+		w = file
+	}
+
+	if diffNameStatus {
+		for _, item := range changes {
+			if _, err := fmt.Fprintf(w, "%s\t%s\n", item.Kind, item.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return overlay.WriteDiff(w, entry.UpperDir, entry.LowerDirs, changes)
+}
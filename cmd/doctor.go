@@ -0,0 +1,327 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	probeTimeout = 5 * time.Second
+)
+
+var (
+	doctorFix bool
+)
+
+var errProbeTimeout = errors.New("not responding")
+
+// problem is something wrong with a workspace, with the repair for it when
+// it can be fixed without losing data.
+type problem struct {
+	name   string
+	detail string
+	fix    func(ctx context.Context) error
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check and repair workspace",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var name string
+		ctx := context.Background()
+		config := GetConfig()
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if err := runDoctor(ctx, config, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().BoolVarP(&doctorFix, "fix", "f", false, "remount broken sshfs and overlay mounts")
+
+	doctorCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s [workspace_name] [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git doctor\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git doctor your_workspace --fix\n")
+		return nil
+	})
+}
+
+func runDoctor(ctx context.Context, cfg *config.Config, name string) error {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	entries := reg.List()
+
+	if name != "" {
+		entry, ok := reg.Get(name)
+		if !ok {
+			return errors.Errorf("workspace %s not found\n", name)
+		}
+		entries = []*registry.Entry{entry}
+	}
+
+	var problems []problem
+
+	for _, entry := range entries {
+		problems = append(problems, diagnoseWorkspace(reg, cfg, entry)...)
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("no problems found\n")
+		return nil
+	}
+
+	data := [][]string{
+		{"NAME", "PROBLEM", "STATUS"},
+	}
+
+	var unresolved int
+
+	for _, item := range problems {
+		var status string
+		switch {
+		case item.fix == nil:
+			status = "needs manual repair"
+			unresolved++
+		case !doctorFix:
+			status = "fixable with --fix"
+			unresolved++
+		default:
+			if err := item.fix(ctx); err != nil {
+				status = "fix failed: " + strings.TrimSpace(err.Error())
+				unresolved++
+			} else {
+				status = "fixed"
+			}
+		}
+		data = append(data, []string{item.name, item.detail, status})
+	}
+
+	if err := utils.WriteTable(ctx, data); err != nil {
+		return err
+	}
+
+	if unresolved > 0 {
+		return errors.Errorf("%d problem(s) left\n", unresolved)
+	}
+
+	return nil
+}
+
+// diagnoseWorkspace checks the sshfs and overlay mounts of a workspace with
+// the mount table and stat probes, in the order they have to be repaired.
+func diagnoseWorkspace(reg *registry.Registry, cfg *config.Config, entry *registry.Entry) []problem {
+	var problems []problem
+
+	report := func(detail string, fix func(ctx context.Context) error) {
+		problems = append(problems, problem{entry.Name, detail, fix})
+	}
+
+	sshfsBroken := false
+
+	if entry.Sshfs != "" {
+		if detail := probeMount(entry.Sshfs); detail != "" {
+			sshfsBroken = true
+			report("sshfs "+detail, func(ctx context.Context) error {
+				return remountSshfs(ctx, reg, cfg, entry)
+			})
+		}
+	}
+
+	if _, err := os.Stat(entry.UpperDir); err != nil {
+		// Mounting again would start from an empty upper layer
+		report(fmt.Sprintf("upper layer %s missing", entry.UpperDir), nil)
+		return problems
+	}
+
+	for _, item := range entry.LowerDirs {
+		if item == entry.Sshfs {
+			continue
+		}
+		if _, err := os.Stat(item); err != nil {
+			report(fmt.Sprintf("lower layer %s missing", item), nil)
+			return problems
+		}
+	}
+
+	remount := func(ctx context.Context) error {
+		if err := detachDeadOverlay(ctx, entry.Mount); err != nil {
+			return err
+		}
+		return mountWorkspace(ctx, entry)
+	}
+
+	switch detail := probeMount(entry.Mount); {
+	case detail != "":
+		report("overlay "+detail, remount)
+	case sshfsBroken:
+		// The overlay keeps the dead sshfs mount as its lower layer
+		report("overlay stacked on broken sshfs mount", remount)
+	}
+
+	return problems
+}
+
+// detachDeadOverlay unmounts an overlay to mount it again. A busy overlay is
+// refused unless it is dead and no process uses it, as one detached lazily
+// can still write to the upper layer mounted a second time, corrupting it.
+func detachDeadOverlay(ctx context.Context, target string) error {
+	mounted, err := mount.IsMounted(target)
+	if err != nil {
+		return err
+	}
+
+	if !mounted {
+		return nil
+	}
+
+	err = mount.UnmountStrict(ctx, target)
+	if errors.Is(err, mount.ErrBusy) {
+		pids, usersErr := mount.Users(target)
+		if usersErr != nil || len(pids) > 0 || !isDead(target) {
+			return errors.Errorf("overlay %s busy%s, close it first", target, busyUsers(target))
+		}
+		err = mount.Unmount(ctx, target)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to unmount overlay")
+	}
+
+	fmt.Printf("successfully unmounted overlay\n")
+
+	return nil
+}
+
+// isDead reports whether the filesystem at target no longer answers, like a
+// FUSE mount whose server is gone or hangs.
+func isDead(target string) bool {
+	err := probe(target)
+	return errors.Is(err, syscall.ENOTCONN) || errors.Is(err, errProbeTimeout)
+}
+
+// probeMount describes what is wrong with a mount point, or returns "" if it
+// is mounted and answers.
+func probeMount(target string) string {
+	mounted, err := mount.IsMounted(target)
+	if err != nil {
+		return err.Error()
+	}
+
+	if !mounted {
+		return "not mounted"
+	}
+
+	if err := probe(target); err != nil {
+		if errors.Is(err, syscall.ENOTCONN) {
+			return "transport endpoint not connected"
+		}
+		return err.Error()
+	}
+
+	return ""
+}
+
+// probe reads dir with a timeout, since a FUSE server that hangs blocks the
+// caller forever.
+func probe(dir string) error {
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := os.ReadDir(dir)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(probeTimeout):
+		return errProbeTimeout
+	}
+}
+
+// remountSshfs mounts the sshfs of a workspace again, trying its recorded
+// port before the configured ones.
+func remountSshfs(ctx context.Context, reg *registry.Registry, cfg *config.Config, entry *registry.Entry) error {
+	// Forks share the sshfs mount, which may have been repaired for another one
+	if probeMount(entry.Sshfs) == "" {
+		return nil
+	}
+
+	if err := UnmountSshfs(ctx, entry.Sshfs); err != nil {
+		return err
+	}
+
+	ports := []int{entry.Port}
+	for _, port := range cfg.Sshfs.Ports {
+		if port != entry.Port {
+			ports = append(ports, port)
+		}
+	}
+
+	var err error
+
+	for _, port := range ports {
+		if port == 0 {
+			continue
+		}
+		if err = MountSshfs(ctx, entry.Source, entry.Sshfs, port); err == nil {
+			entry.Port = port
+			return reg.Put(entry)
+		}
+	}
+
+	if err == nil {
+		err = errors.New("no sshfs port configured")
+	}
+
+	return err
+}
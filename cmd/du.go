@@ -0,0 +1,200 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	duWorkers = 8
+)
+
+var (
+	duFormat string
+	duOutput string
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Show disk usage of workspace",
+	Args:  cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var name string
+		ctx := context.Background()
+		config := GetConfig()
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if err := runDu(ctx, config, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(duCmd)
+
+	duCmd.Flags().StringVarP(&duFormat, "format", "f", "", "print each workspace with a Go template")
+	duCmd.Flags().StringVarP(&duOutput, "output", "o", utils.OutputTable, "output format (table, wide, json or yaml)")
+
+	duCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s [workspace_name] [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git du your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git du --output json\n")
+		return nil
+	})
+}
+
+func runDu(ctx context.Context, cfg *config.Config, name string) error {
+	if err := utils.ValidateOutput(duOutput, duFormat); err != nil {
+		return err
+	}
+
+	all, err := QueryWorkspaces(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+
+	var workspaces []Workspace
+
+	for _, item := range all {
+		if name == "" || item.Name == name {
+			workspaces = append(workspaces, item)
+		}
+	}
+
+	if name != "" && len(workspaces) == 0 {
+		return errors.Errorf("workspace %s not found\n", name)
+	}
+
+	measureWorkspaces(ctx, workspaces)
+
+	return utils.WriteOutput(ctx, duOutput, duFormat, workspaces, func(wide bool) error {
+		data := [][]string{
+			{"NAME", "SIZE", "ADDED", "MODIFIED", "DELETED", "LAST MODIFIED"},
+		}
+		if wide {
+			data[0] = append(data[0], "UPPER")
+		}
+		for _, item := range workspaces {
+			row := []string{item.Name, "N/A", "N/A", "N/A", "N/A", "N/A"}
+			if item.measured {
+				row[1] = utils.FormatSize(item.UpperSize)
+				row[5] = item.LastModified
+			}
+			if item.counted {
+				row[2], row[3], row[4] = strconv.Itoa(item.Added), strconv.Itoa(item.Modified), strconv.Itoa(item.Deleted)
+			}
+			if wide {
+				row = append(row, item.Upper)
+			}
+			data = append(data, row)
+		}
+		return utils.WriteTable(ctx, data)
+	})
+}
+
+// measureWorkspaces fills in the disk usage of the workspaces with a known
+// upper layer, walking a few of them at a time so listing dozens stays fast.
+func measureWorkspaces(ctx context.Context, workspaces []Workspace) {
+	jobs := make(chan *Workspace)
+
+	var wg sync.WaitGroup
+
+	for range min(runtime.NumCPU(), duWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				measureWorkspace(item)
+			}
+		}()
+	}
+
+loop:
+	for i := range workspaces {
+		if workspaces[i].Name == "" || workspaces[i].Upper == "" {
+			continue
+		}
+		select {
+		case jobs <- &workspaces[i]:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+func measureWorkspace(item *Workspace) {
+	usage, err := overlay.DiskUsage(item.Upper, item.Lowers...)
+	if err != nil {
+		return
+	}
+
+	item.UpperSize = usage.Size
+	item.LastModified = usage.LastModified.Local().Format("2006-01-02 15:04:05")
+	item.measured = true
+
+	// Without lower layers every file would count as added
+	if len(item.Lowers) > 0 {
+		item.Added, item.Modified, item.Deleted = usage.Added, usage.Modified, usage.Deleted
+		item.counted = true
+	}
+}
+
+// usageColumns returns the SIZE, CHANGES and MODIFIED columns of list.
+func usageColumns(item Workspace) []string {
+	switch {
+	case item.Name == "":
+		return []string{"", "", ""}
+	case !item.measured:
+		return []string{"N/A", "N/A", "N/A"}
+	}
+
+	changes := "N/A"
+	if item.counted {
+		changes = fmt.Sprintf("+%d ~%d -%d", item.Added, item.Modified, item.Deleted)
+	}
+
+	return []string{utils.FormatSize(item.UpperSize), changes, item.LastModified}
+}
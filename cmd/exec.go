@@ -0,0 +1,218 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/sandbox"
+)
+
+const (
+	// Exit code of timeout(1) when the command timed out
+	execTimeoutCode = 124
+	execWaitDelay   = 10 * time.Second
+)
+
+var (
+	execEnv       []string
+	execTimeout   time.Duration
+	execSandbox   bool
+	execNoNetwork bool
+	execCpus      float64
+	execMemory    string
+	execPids      int64
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec",
+	Short: "Execute command in workspace",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		name := args[0]
+		code, err := runExec(ctx, config, name, args[1:])
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		os.Exit(code)
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(execCmd)
+
+	execCmd.Flags().StringArrayVarP(&execEnv, "env", "e", nil, "set environment variable KEY=VAL (repeatable)")
+	execCmd.Flags().DurationVarP(&execTimeout, "timeout", "t", 0, "kill command after this long, like 10m")
+	execCmd.Flags().BoolVarP(&execSandbox, "sandbox", "s", false, "run in namespaces with only the workspace writable")
+	execCmd.Flags().BoolVarP(&execNoNetwork, "no-network", "n", false, "cut the sandbox off the network")
+	execCmd.Flags().Float64VarP(&execCpus, "cpus", "C", 0, "limit CPUs of the command like 1.5, overrides limits.cpus")
+	execCmd.Flags().StringVarP(&execMemory, "memory", "m", "", "limit memory of the command like 4G, overrides limits.memory")
+	execCmd.Flags().Int64VarP(&execPids, "pids", "p", 0, "limit processes of the command, overrides limits.pids")
+
+	// Flags after the workspace name belong to the command
+	execCmd.Flags().SetInterspersed(false)
+
+	execCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s [flags] <workspace_name> -- <command> [args...]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git exec your_workspace -- make test\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git exec --env GOFLAGS=-count=1 --timeout 10m your_workspace -- go test ./...\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git exec --sandbox --no-network your_workspace -- make test\n")
+		return nil
+	})
+}
+
+// runExec runs args in the workspace mount and returns the exit code of the
+// command.
+func runExec(ctx context.Context, cfg *config.Config, name string, args []string) (int, error) {
+	// The dash stays in args once flag parsing stopped at the workspace name
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return 0, errors.New("command is required\n")
+	}
+
+	if execNoNetwork && !execSandbox {
+		return 0, errors.New("--no-network requires --sandbox\n")
+	}
+
+	limits, err := sessionLimits(cfg, execCpus, execMemory, execPids)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range execEnv {
+		if key, _, ok := strings.Cut(item, "="); !ok || key == "" {
+			return 0, errors.Errorf("invalid environment variable %s, expected KEY=VAL\n", item)
+		}
+	}
+
+	workspaces, err := QueryWorkspaces(ctx, cfg, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var workspace *Workspace
+
+	for i := range workspaces {
+		if workspaces[i].Name == name {
+			workspace = &workspaces[i]
+			break
+		}
+	}
+
+	if workspace == nil {
+		return 0, errors.Errorf("workspace %s not found\n", name)
+	}
+
+	mounted, err := mount.IsMounted(workspace.Mount)
+	if err != nil {
+		return 0, err
+	}
+
+	if !mounted {
+		return 0, errors.Errorf("workspace %s is not mounted at %s, run '%s up %s' first\n", name, workspace.Mount, rootCmd.Use, name)
+	}
+
+	if execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, execTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = workspace.Mount
+	cmd.Env = append(os.Environ(), execEnv...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Give the command a chance to clean up before it is killed
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = execWaitDelay
+
+	if execSandbox {
+		if err := sandbox.Wrap(cmd, sandbox.Options{Writable: workspace.Mount, NoNetwork: execNoNetwork}); err != nil {
+			return 0, errors.Wrapf(err, "failed to run %s\n", args[0])
+		}
+	}
+
+	defer limitSession(cmd, name, limits)()
+
+	if err := cmd.Start(); err != nil {
+		return 0, errors.Wrapf(err, "failed to run %s\n", args[0])
+	}
+
+	// Pass signals on and leave it to the command whether to exit on them
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	go func() {
+		for sig := range sigChan {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		_, _ = fmt.Fprintf(os.Stderr, "command timed out after %s\n", execTimeout)
+		return execTimeoutCode, nil
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, errors.Wrapf(err, "failed to wait for %s\n", args[0])
+		}
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,170 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/utils"
+)
+
+var forkCmd = &cobra.Command{
+	Use:   "fork",
+	Short: "Fork workspace into new workspace",
+	Args:  cobra.RangeArgs(2, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		src := args[0]
+		name := args[1]
+		if err := runFork(ctx, config, src, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(forkCmd)
+
+	forkCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <src_workspace_name> <new_workspace_name> [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git fork your_workspace your_new_workspace\n")
+		return nil
+	})
+}
+
+func runFork(ctx context.Context, cfg *config.Config, src, name string) error {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	source, ok := reg.Get(src)
+	if !ok {
+		return errors.Errorf("workspace %s not found\n", src)
+	}
+
+	if _, ok := reg.Get(name); ok {
+		return errors.Errorf("workspace %s already exists\n", name)
+	}
+
+	if len(source.LowerDirs) == 0 {
+		return errors.Errorf("workspace %s has no recorded lower directory\n", src)
+	}
+
+	overlayPath := path.Join(utils.ExpandTilde(cfg.Overlay.Mount), name)
+	frozenPath := frozenDir(overlayPath)
+
+	if _, err := os.Stat(frozenPath); err == nil {
+		return errors.Errorf("directory %s already exists\n", frozenPath)
+	}
+
+	if err := ensureMountDirectories(overlayPath); err != nil {
+		return errors.New("failed to create directory\n")
+	}
+
+	// The source keeps running, its upper layer is copied as it is now
+	if err := copyLayer(source.UpperDir, frozenPath); err != nil {
+		_ = removeDir(frozenPath)
+		return errors.Wrap(err, "failed to copy upper layer\n")
+	}
+
+	entry := &registry.Entry{
+		Name:      name,
+		Source:    source.Source,
+		Mount:     overlayPath,
+		LowerDirs: append([]string{frozenPath}, source.LowerDirs...),
+		Sshfs:     source.Sshfs,
+		Port:      source.Port,
+	}
+	entry.UpperDir, entry.WorkDir = overlayDirs(overlayPath)
+
+	// Whiteouts in the frozen layer are in the format of the source backend
+	backend, err := MountOverlay(ctx, source.Backend, entry.LowerDirs, overlayPath)
+	if err != nil {
+		_ = removeDir(frozenPath)
+		return err
+	}
+
+	entry.Backend = backend
+
+	// Both work on the same repo, so the fork finds conflicts from the same base
+	if err := copyManifest(reg, src, name); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %v, apply falls back to modification times\n", err)
+	}
+
+	if err := reg.Put(entry); err != nil {
+		_ = UnmountOverlay(ctx, overlayPath)
+		_ = removeDir(frozenPath)
+		return errors.Wrap(err, "failed to record workspace\n")
+	}
+
+	fmt.Printf("forked workspace %s into %s\n", src, name)
+
+	return nil
+}
+
+// copyLayer copies an upper layer to dst keeping whiteouts and opaque
+// directories, so it behaves the same when stacked as a lower layer.
+func copyLayer(src, dst string) error {
+	reader, writer := io.Pipe()
+
+	go func() {
+		_ = writer.CloseWithError(overlay.Archive(writer, src))
+	}()
+
+	err := overlay.Extract(reader, dst)
+	_ = reader.CloseWithError(err)
+
+	return err
+}
+
+// copyManifest gives a fork the repo files recorded for its source.
+func copyManifest(reg *registry.Registry, src, dst string) error {
+	base, err := overlay.ReadManifest(manifestPath(reg, src))
+	if err != nil {
+		return err
+	}
+
+	if base == nil {
+		_ = os.Remove(manifestPath(reg, dst))
+		return nil
+	}
+
+	return overlay.WriteManifest(manifestPath(reg, dst), base)
+}
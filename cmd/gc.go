@@ -0,0 +1,395 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/cgroup"
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	// Directories younger than this may belong to a create still running
+	gcGrace = 10 * time.Minute
+)
+
+var (
+	gcOlderThan string
+	gcYes       bool
+)
+
+// garbage is something gc can reclaim.
+type garbage struct {
+	path   string
+	reason string
+	size   int64
+	remove func(ctx context.Context) error
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove orphaned workspace directories",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		if err := runGc(ctx, config); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(gcCmd)
+
+	gcCmd.Flags().StringVarP(&gcOlderThan, "older-than", "t", "", "also delete workspaces idle for longer than this, like 7d or 12h")
+	gcCmd.Flags().BoolVarP(&gcYes, "yes", "y", false, "remove without asking, otherwise only show what would be removed")
+
+	gcCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git gc\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git gc --yes\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git gc --older-than 7d --yes\n")
+		return nil
+	})
+}
+
+func runGc(ctx context.Context, cfg *config.Config) error {
+	var olderThan time.Duration
+
+	if gcOlderThan != "" {
+		var err error
+		if olderThan, err = parseAge(gcOlderThan); err != nil {
+			return err
+		}
+	}
+
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	mounts, err := mount.Mounts()
+	if err != nil {
+		return err
+	}
+
+	items := findOrphans(reg, cfg, mounts)
+
+	if olderThan > 0 {
+		items = append(items, findIdle(cfg, reg, mounts, time.Now().Add(-olderThan))...)
+	}
+
+	if len(items) == 0 {
+		fmt.Printf("nothing to reclaim\n")
+		return nil
+	}
+
+	data := [][]string{
+		{"PATH", "SIZE", "REASON"},
+	}
+
+	var total int64
+
+	for _, item := range items {
+		total += item.size
+		data = append(data, []string{item.path, utils.FormatSize(item.size), item.reason})
+	}
+
+	if err := utils.WriteTable(ctx, data); err != nil {
+		return err
+	}
+
+	if !gcYes {
+		fmt.Printf("would reclaim %s from %d item(s), run with --yes to remove them\n", utils.FormatSize(total), len(items))
+		return nil
+	}
+
+	var reclaimed int64
+	var failed int
+
+	for _, item := range items {
+		if err := item.remove(ctx); err != nil {
+			fmt.Println(strings.TrimSpace(err.Error()))
+			failed++
+			continue
+		}
+		reclaimed += item.size
+	}
+
+	fmt.Printf("reclaimed %s from %d item(s)\n", utils.FormatSize(reclaimed), len(items)-failed)
+
+	if failed > 0 {
+		return errors.Errorf("failed to remove %d item(s)\n", failed)
+	}
+
+	return nil
+}
+
+// findOrphans returns the layer, mount and state directories no recorded or
+// mounted workspace uses.
+func findOrphans(reg *registry.Registry, cfg *config.Config, mounts []mount.Info) []garbage {
+	var items []garbage
+
+	known := map[string]bool{}
+
+	for _, entry := range reg.List() {
+		for _, item := range append([]string{entry.Mount, entry.UpperDir, entry.WorkDir, entry.Sshfs}, entry.LowerDirs...) {
+			if item != "" {
+				known[path.Clean(item)] = true
+			}
+		}
+	}
+
+	// Anything with a mount on or below it is in use
+	inUse := func(dir string) bool {
+		for _, item := range mounts {
+			if item.Mountpoint == dir || strings.HasPrefix(item.Mountpoint, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	add := func(dir, reason string) {
+		usage, err := overlay.DiskUsage(dir)
+		if err != nil {
+			// Unreadable leftovers are still removed, only their size is unknown
+			info, statErr := os.Stat(dir)
+			if statErr != nil {
+				return
+			}
+			usage = overlay.Usage{LastModified: info.ModTime()}
+		}
+		if time.Since(usage.LastModified) < gcGrace {
+			return
+		}
+		items = append(items, garbage{dir, reason, usage.Size, func(context.Context) error {
+			return removeDir(dir)
+		}})
+	}
+
+	overlayPath := path.Clean(utils.ExpandTilde(cfg.Overlay.Mount))
+
+	for _, name := range subdirs(overlayPath) {
+		dir := path.Join(overlayPath, name)
+		if known[dir] || inUse(dir) {
+			continue
+		}
+		prefix, owner, ok := strings.Cut(name, "-")
+		switch {
+		case ok && isInternalDir(name):
+			// Workspaces created before the registry are only known by their
+			// mount directory, which stays when they are not mounted
+			if inUse(path.Join(overlayPath, owner)) || exists(path.Join(overlayPath, owner)) {
+				continue
+			}
+			add(dir, fmt.Sprintf("orphaned %s layer", prefix))
+		case isEmptyDir(dir):
+			// An unmounted workspace has an empty mount directory next to its layers
+			if upper, _ := overlayDirs(dir); exists(upper) {
+				continue
+			}
+			add(dir, "empty mount directory")
+		}
+	}
+
+	sshfsPath := path.Clean(utils.ExpandTilde(cfg.Sshfs.Mount))
+
+	if sshfsPath != overlayPath {
+		for _, name := range subdirs(sshfsPath) {
+			dir := path.Join(sshfsPath, name)
+			if !known[dir] && !inUse(dir) && isEmptyDir(dir) {
+				add(dir, "empty sshfs mount directory")
+			}
+		}
+	}
+
+	statePath := reg.StateDir("")
+
+	for _, name := range subdirs(statePath) {
+		if _, ok := reg.Get(name); ok {
+			continue
+		}
+		// Chat sessions of workspaces created before the registry live here too
+		if exists(path.Join(overlayPath, name)) {
+			continue
+		}
+		dir := path.Join(statePath, name)
+		if isEmptyDir(dir) {
+			add(dir, "state of deleted workspace")
+			continue
+		}
+		// Recordings outlive their workspace so sessions can still be replayed
+		for _, item := range stateEntries(dir) {
+			add(item, "state of deleted workspace")
+		}
+	}
+
+	return items
+}
+
+// exists reports whether there is anything at name.
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return err == nil
+}
+
+// stateEntries returns what a state directory holds except recordings, which
+// gc never removes.
+func stateEntries(dir string) []string {
+	var names []string
+
+	entries, _ := os.ReadDir(dir)
+
+	for _, item := range entries {
+		if item.Name() != recordingsDirName {
+			names = append(names, path.Join(dir, item.Name()))
+		}
+	}
+
+	return names
+}
+
+// busyWorkspace reports whether a workspace is in use: something is mounted
+// below its overlay, a process works in it, or a session still runs in its
+// cgroup.
+func busyWorkspace(entry *registry.Entry, mounts []mount.Info) bool {
+	dir := path.Clean(entry.Mount)
+
+	for _, item := range mounts {
+		if strings.HasPrefix(item.Mountpoint, dir+"/") {
+			return true
+		}
+	}
+
+	if pids, err := mount.Users(dir); err != nil || len(pids) > 0 {
+		return true
+	}
+
+	if cg, err := cgroup.Open(entry.Name); err == nil && cg != nil && cg.Populated() {
+		return true
+	}
+
+	return false
+}
+
+// findIdle returns the recorded workspaces that were neither changed nor
+// updated since before and are not in use.
+func findIdle(cfg *config.Config, reg *registry.Registry, mounts []mount.Info, before time.Time) []garbage {
+	var items []garbage
+
+	for _, entry := range reg.List() {
+		if busyWorkspace(entry, mounts) {
+			continue
+		}
+		usage, err := overlay.DiskUsage(entry.UpperDir)
+		if err != nil {
+			continue
+		}
+		last := usage.LastModified
+		for _, item := range []time.Time{entry.UpdatedAt, entry.AppliedAt} {
+			if item.After(last) {
+				last = item
+			}
+		}
+		if !last.Before(before) {
+			continue
+		}
+		name := entry.Name
+		items = append(items, garbage{entry.Mount, "idle since " + last.Local().Format("2006-01-02 15:04:05"), usage.Size, func(ctx context.Context) error {
+			if err := deleteWorkspace(ctx, cfg, reg, name); err != nil {
+				return err
+			}
+			if _, ok := reg.Get(name); ok {
+				return errors.Errorf("failed to delete workspace %s\n", name)
+			}
+			for _, item := range stateEntries(reg.StateDir(name)) {
+				if err := removeDir(item); err != nil {
+					return err
+				}
+			}
+			// Only an empty state directory goes, recordings are kept
+			_ = os.Remove(reg.StateDir(name))
+			return nil
+		}})
+	}
+
+	return items
+}
+
+// parseAge parses a duration that may also be given in days, like 7d.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.Errorf("invalid age %s\n", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	age, err := time.ParseDuration(s)
+	if err != nil || age <= 0 {
+		return 0, errors.Errorf("invalid age %s\n", s)
+	}
+
+	return age, nil
+}
+
+func subdirs(dir string) []string {
+	var names []string
+
+	entries, _ := os.ReadDir(dir)
+
+	for _, item := range entries {
+		if item.IsDir() {
+			names = append(names, item.Name())
+		}
+	}
+
+	return names
+}
+
+func isEmptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) == 0
+}
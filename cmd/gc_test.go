@@ -0,0 +1,268 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/registry"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"7d", 7 * 24 * time.Hour},
+		{"1d", 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"", 0},
+		{"d", 0},
+		{"0d", 0},
+		{"-1d", 0},
+		{"1.5d", 0},
+		{"0h", 0},
+		{"-2h", 0},
+		{"week", 0},
+	}
+
+	for _, test := range tests {
+		got, err := parseAge(test.input)
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("parseAge(%q) = %v, want error", test.input, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseAge(%q) = %v, %v, want %v", test.input, got, err, test.want)
+		}
+	}
+}
+
+// gcFixture returns a config and registry living below a temp directory.
+func gcFixture(t *testing.T) (string, *config.Config, *registry.Registry) {
+	t.Helper()
+
+	base := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Overlay.Mount = filepath.Join(base, "overlay")
+	cfg.Sshfs.Mount = filepath.Join(base, "sshfs")
+
+	reg, err := registry.Open(filepath.Join(base, "state", "workspaces.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base, cfg, reg
+}
+
+// addWorkspace records a workspace with its directories in the overlay dir.
+func addWorkspace(t *testing.T, cfg *config.Config, reg *registry.Registry, name string) *registry.Entry {
+	t.Helper()
+
+	entry := &registry.Entry{
+		Name:      name,
+		Mount:     filepath.Join(cfg.Overlay.Mount, name),
+		LowerDirs: []string{filepath.Join(cfg.Overlay.Mount, "repo")},
+	}
+	entry.UpperDir, entry.WorkDir = overlayDirs(entry.Mount)
+
+	for _, dir := range []string{entry.Mount, entry.WorkDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestFile(t, entry.UpperDir, "file", "content\n")
+
+	if err := reg.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	return entry
+}
+
+// ageTree moves the times of everything below dir past the gc grace period.
+func ageTree(t *testing.T, dir string) {
+	t.Helper()
+
+	past := time.Now().Add(-2 * gcGrace)
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(p, past, past)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func garbagePaths(items []garbage) []string {
+	var paths []string
+
+	for _, item := range items {
+		paths = append(paths, item.path)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func TestFindOrphans(t *testing.T) {
+	base, cfg, reg := gcFixture(t)
+
+	addWorkspace(t, cfg, reg, "ws")
+
+	overlayPath := cfg.Overlay.Mount
+	statePath := reg.StateDir("")
+
+	for _, dir := range []string{
+		filepath.Join(overlayPath, "empty"),
+		filepath.Join(overlayPath, "mounted"),
+		filepath.Join(overlayPath, "work-gone"),
+		filepath.Join(cfg.Sshfs.Mount, "gone"),
+		filepath.Join(statePath, "vacant"),
+		filepath.Join(overlayPath, "legacy"),
+		filepath.Join(overlayPath, "work-legacy"),
+	} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeTestFile(t, overlayPath, "upper-gone/file", "orphan\n")
+	writeTestFile(t, overlayPath, "upper-busy/file", "orphan\n")
+	writeTestFile(t, overlayPath, "project/file", "not empty\n")
+	writeTestFile(t, statePath, "ws/sessions/chat.json", "{}\n")
+	writeTestFile(t, statePath, "deleted/sessions/chat.json", "{}\n")
+	writeTestFile(t, statePath, "deleted/snapshots/s1.tar.gz", "tar\n")
+	writeTestFile(t, statePath, "deleted/recordings/1.cast", "cast\n")
+	writeTestFile(t, statePath, "recorded/recordings/1.cast", "cast\n")
+
+	// A workspace from before the registry that is not mounted, after a reboot
+	writeTestFile(t, overlayPath, "upper-legacy/work", "uncommitted\n")
+	writeTestFile(t, statePath, "legacy/sessions/chat.json", "{}\n")
+
+	ageTree(t, base)
+
+	// Fresh directories may belong to a create still running
+	writeTestFile(t, overlayPath, "upper-fresh/file", "new\n")
+
+	mounts := []mount.Info{
+		{Mountpoint: filepath.Join(overlayPath, "mounted"), FSType: "tmpfs"},
+		{Mountpoint: filepath.Join(overlayPath, "busy"), FSType: "overlay"},
+	}
+
+	want := []string{
+		filepath.Join(overlayPath, "empty"),
+		filepath.Join(overlayPath, "upper-gone"),
+		filepath.Join(overlayPath, "work-gone"),
+		filepath.Join(cfg.Sshfs.Mount, "gone"),
+		filepath.Join(statePath, "deleted", "sessions"),
+		filepath.Join(statePath, "deleted", "snapshots"),
+		filepath.Join(statePath, "vacant"),
+	}
+	sort.Strings(want)
+
+	items := findOrphans(reg, cfg, mounts)
+
+	got := garbagePaths(items)
+	if len(got) != len(want) {
+		t.Fatalf("findOrphans() = %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("findOrphans()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	for _, item := range items {
+		if err := item.remove(context.Background()); err != nil {
+			t.Errorf("removing %s failed: %v", item.path, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(statePath, "deleted", "recordings", "1.cast")); err != nil {
+		t.Errorf("expected recordings of deleted workspace to be kept, got %v", err)
+	}
+
+	for _, name := range []string{"legacy", "upper-legacy/work", "work-legacy"} {
+		if _, err := os.Stat(filepath.Join(overlayPath, name)); err != nil {
+			t.Errorf("expected unmounted workspace to be kept, got %v", err)
+		}
+	}
+}
+
+func TestFindIdle(t *testing.T) {
+	base, cfg, reg := gcFixture(t)
+
+	idle := addWorkspace(t, cfg, reg, "idle")
+	nested := addWorkspace(t, cfg, reg, "nested")
+	used := addWorkspace(t, cfg, reg, "used")
+
+	writeTestFile(t, reg.StateDir("idle"), "sessions/chat.json", "{}\n")
+	writeTestFile(t, reg.StateDir("idle"), "recordings/1.cast", "cast\n")
+
+	ageTree(t, base)
+
+	cmd := exec.Command("sleep", "60")
+	cmd.Dir = used.Mount
+
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	mounts := []mount.Info{
+		{Mountpoint: filepath.Join(nested.Mount, "cache"), FSType: "tmpfs"},
+	}
+
+	// Registry updates are recent, so every workspace counts as idle by time
+	items := findIdle(cfg, reg, mounts, time.Now().Add(time.Hour))
+
+	if got := garbagePaths(items); len(got) != 1 || got[0] != idle.Mount {
+		t.Fatalf("findIdle() = %v, want [%s]", got, idle.Mount)
+	}
+
+	if got := findIdle(cfg, reg, mounts, time.Now().Add(-time.Hour)); len(got) != 0 {
+		t.Errorf("findIdle() before last change = %v, want none", garbagePaths(got))
+	}
+
+	if err := items[0].remove(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := reg.Get("idle"); ok {
+		t.Error("expected idle workspace to be deleted")
+	}
+
+	for _, dir := range []string{idle.Mount, idle.UpperDir, filepath.Join(reg.StateDir("idle"), "sessions")} {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", dir, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(reg.StateDir("idle"), "recordings", "1.cast")); err != nil {
+		t.Errorf("expected recordings of idle workspace to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+//go:build linux
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/cgroup"
+	"github.com/repo-scm/git/config"
+)
+
+const (
+	// cpu.max takes no quota below 1ms per 100ms period
+	minCPUs = 0.01
+)
+
+// sessionLimits returns the resource limits of a session, taken from the
+// flags and for those not given from the config defaults.
+func sessionLimits(cfg *config.Config, cpus float64, memory string, pids int64) (cgroup.Limits, error) {
+	if cpus == 0 {
+		cpus = cfg.Limits.Cpus
+	}
+
+	if memory == "" {
+		memory = cfg.Limits.Memory
+	}
+
+	if pids == 0 {
+		pids = cfg.Limits.Pids
+	}
+
+	limits := cgroup.Limits{CPUs: cpus, Pids: pids}
+
+	if cpus < 0 || (cpus > 0 && cpus < minCPUs) {
+		return limits, errors.Errorf("invalid cpus %g, expected at least %g\n", cpus, minCPUs)
+	}
+
+	if pids < 0 {
+		return limits, errors.Errorf("invalid pids %d\n", pids)
+	}
+
+	if memory != "" {
+		var err error
+		if limits.Memory, err = cgroup.ParseMemory(memory); err != nil {
+			return limits, errors.Errorf("invalid memory limit %s, expected a size like 4G\n", memory)
+		}
+	}
+
+	return limits, nil
+}
+
+// limitSession starts cmd in the cgroup of workspace name with limits. The
+// session runs without limits, and a warning, where cgroups cannot be
+// delegated. cleanup removes the cgroup when cmd was the last session in it.
+func limitSession(cmd *exec.Cmd, name string, limits cgroup.Limits) (cleanup func()) {
+	cleanup = func() {}
+
+	if limits.IsZero() {
+		return cleanup
+	}
+
+	cg, skipped, err := cgroup.Create(name, limits)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: running without resource limits: %v\n", err)
+		return cleanup
+	}
+
+	if len(skipped) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s limit not applied, controller not delegated\n", strings.Join(skipped, ", "))
+	}
+
+	closeFd, err := cg.Attach(cmd)
+	if err != nil {
+		// Older kernels and some container seccomp filters lack clone3
+		if errors.Is(err, syscall.ENOSYS) {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: running without resource limits, this kernel cannot start sessions in a cgroup: %v\n", err)
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: running without resource limits: %v\n", err)
+		}
+		_ = cg.Remove()
+		return cleanup
+	}
+
+	return func() {
+		closeFd()
+		_ = cg.Remove()
+	}
+}
@@ -7,19 +7,33 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	"github.com/repo-scm/git/cgroup"
 	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
 	"github.com/repo-scm/git/utils"
 )
 
+const (
+	healthOK        = "ok"
+	healthUnmounted = "unmounted"
+	healthBroken    = "broken"
+	healthUnknown   = "unknown"
+)
+
 var (
+	listFormat  string
+	listOutput  string
 	verboseMode bool
 )
 
@@ -42,16 +56,31 @@ var listCmd = &cobra.Command{
 }
 
 type Workspace struct {
-	Name       string
-	Mount      string
-	Filesystem string
-	Created    string
+	Name         string        `json:"name" yaml:"name"`
+	Mount        string        `json:"mount" yaml:"mount"`
+	Filesystem   string        `json:"filesystem" yaml:"filesystem"`
+	Created      string        `json:"created" yaml:"created"`
+	Source       string        `json:"source,omitempty" yaml:"source,omitempty"`
+	Upper        string        `json:"upper,omitempty" yaml:"upper,omitempty"`
+	Lowers       []string      `json:"lowers,omitempty" yaml:"lowers,omitempty"`
+	UpperSize    int64         `json:"upper_size" yaml:"upper_size"`
+	Added        int           `json:"added" yaml:"added"`
+	Modified     int           `json:"modified" yaml:"modified"`
+	Deleted      int           `json:"deleted" yaml:"deleted"`
+	LastModified string        `json:"last_modified,omitempty" yaml:"last_modified,omitempty"`
+	Backend      string        `json:"backend,omitempty" yaml:"backend,omitempty"`
+	Health       string        `json:"health,omitempty" yaml:"health,omitempty"`
+	Resources    *cgroup.Usage `json:"resources,omitempty" yaml:"resources,omitempty"`
+	measured     bool
+	counted      bool
 }
 
 // nolint:gochecknoinits
 func init() {
 	rootCmd.AddCommand(listCmd)
 
+	listCmd.PersistentFlags().StringVarP(&listFormat, "format", "f", "", "print each workspace with a Go template")
+	listCmd.PersistentFlags().StringVarP(&listOutput, "output", "o", utils.OutputTable, "output format (table, wide, json or yaml)")
 	listCmd.PersistentFlags().BoolVarP(&verboseMode, "verbose", "v", false, "list in verbose mode")
 
 	listCmd.SetUsageFunc(func(cmd *cobra.Command) error {
@@ -82,13 +111,15 @@ func init() {
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git list your_workspace --verbose\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git list\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git list --verbose\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git list --output json\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git list --format '{{.Name}} {{.Mount}}'\n")
 		return nil
 	})
 }
 
 func runList(ctx context.Context, cfg *config.Config, name string) error {
-	data := [][]string{
-		{"NAME", "MOUNT", "FILESYSTEM", "CREATED"},
+	if err := utils.ValidateOutput(listOutput, listFormat); err != nil {
+		return err
 	}
 
 	workspaces, err := QueryWorkspaces(ctx, cfg, verboseMode)
@@ -97,99 +128,238 @@ func runList(ctx context.Context, cfg *config.Config, name string) error {
 	}
 
 	if name != "" {
+		var selected []Workspace
+		// Layer rows follow the workspace row they belong to
+		var owned bool
 		for _, item := range workspaces {
+			if item.Name != "" {
+				owned = item.Name == name
+			}
 			if verboseMode {
-				if strings.HasSuffix(path.Base(item.Mount), name) {
-					data = append(data, []string{item.Name, item.Mount, item.Filesystem, item.Created})
+				if owned || strings.HasSuffix(path.Base(item.Mount), name) {
+					selected = append(selected, item)
 				}
 			} else {
 				if item.Name == name {
-					data = append(data, []string{item.Name, item.Mount, item.Filesystem, item.Created})
+					selected = append(selected, item)
 				}
 			}
 		}
-		if err := utils.WriteTable(ctx, data); err != nil {
-			return err
-		}
-		return nil
+		workspaces = selected
 	}
 
-	for _, item := range workspaces {
-		data = append(data, []string{item.Name, item.Mount, item.Filesystem, item.Created})
+	// Sizes and changes walk every upper layer, which the plain table leaves
+	// out to stay fast
+	if listFormat != "" || (listOutput != "" && listOutput != utils.OutputTable) {
+		measureWorkspaces(ctx, workspaces)
 	}
 
-	if err := utils.WriteTable(ctx, data); err != nil {
-		return err
+	if verboseMode {
+		readResources(workspaces)
+	}
+
+	// Layer rows only make sense in a table, the others get one record per workspace
+	var records []Workspace
+	for _, item := range workspaces {
+		if item.Name != "" {
+			records = append(records, item)
+		}
 	}
 
-	return nil
+	return utils.WriteOutput(ctx, listOutput, listFormat, records, func(wide bool) error {
+		data := [][]string{
+			{"NAME", "MOUNT", "FILESYSTEM", "CREATED"},
+		}
+		if wide {
+			data[0] = append(data[0], "SIZE", "CHANGES", "MODIFIED", "SOURCE", "BACKEND", "HEALTH")
+		}
+		if verboseMode {
+			data[0] = append(data[0], "CPU", "MEMORY", "PIDS")
+		}
+		for _, item := range workspaces {
+			row := []string{item.Name, item.Mount, item.Filesystem, item.Created}
+			if wide {
+				row = append(row, usageColumns(item)...)
+				row = append(row, item.Source, item.Backend, item.Health)
+			}
+			if verboseMode {
+				row = append(row, resourceColumns(item)...)
+			}
+			data = append(data, row)
+		}
+		return utils.WriteTable(ctx, data)
+	})
 }
 
 func QueryWorkspaces(ctx context.Context, cfg *config.Config, verbose bool) ([]Workspace, error) {
-	var workspaces []Workspace
+	reg, err := registry.Open("")
+	if err != nil {
+		return nil, err
+	}
 
 	overlayPath := utils.ExpandTilde(cfg.Overlay.Mount)
 
-	mountedWorkspaces, err := getWorkspacesFromMount(ctx, overlayPath, verbose)
+	var discovered []Workspace
+
+	mounts, err := mount.Mounts()
 	if err != nil {
-		return getWorkspacesFromFilesystem(overlayPath, cfg, verbose)
+		if discovered, err = getWorkspacesFromFilesystem(overlayPath, cfg, verbose); err != nil {
+			return nil, err
+		}
+	} else {
+		discovered = getWorkspacesFromMount(mounts, overlayPath, verbose)
+		if verbose {
+			sshfsPath := utils.ExpandTilde(cfg.Sshfs.Mount)
+			discovered = append(discovered, getWorkspacesFromMount(mounts, sshfsPath, verbose)...)
+		}
 	}
 
-	workspaces = append(workspaces, mountedWorkspaces...)
+	workspaces, known := getWorkspacesFromRegistry(reg, mounts, verbose)
 
-	if verbose {
-		sshfsPath := utils.ExpandTilde(cfg.Sshfs.Mount)
-		sshfsWorkspaces, err := getWorkspacesFromMount(ctx, sshfsPath, verbose)
-		if err != nil {
-			sshfsWorkspaces = getSshfsWorkspacesFromFilesystem(sshfsPath)
+	// Keep listing workspaces created before the registry existed
+	owned := false
+	for _, item := range discovered {
+		// Layers read from the mount belong to the workspace listed above them
+		if isLayerRow(item) {
+			if owned {
+				workspaces = append(workspaces, item)
+			}
+			continue
 		}
-		workspaces = append(workspaces, sshfsWorkspaces...)
+		owned = false
+		if known[path.Clean(item.Mount)] || (item.Name != "" && known[item.Name]) {
+			continue
+		}
+		owned = item.Name != ""
+		workspaces = append(workspaces, item)
 	}
 
 	return workspaces, nil
 }
 
-func getWorkspacesFromMount(ctx context.Context, basePath string, verbose bool) ([]Workspace, error) {
-	var workspaces []Workspace
+// readResources reads what the running sessions of each workspace use from
+// its cgroup. Workspaces without a session running have none.
+func readResources(workspaces []Workspace) {
+	for i := range workspaces {
+		if workspaces[i].Name == "" {
+			continue
+		}
+		if cg, err := cgroup.Open(workspaces[i].Name); err == nil && cg != nil {
+			usage := cg.Usage()
+			workspaces[i].Resources = &usage
+		}
+	}
+}
 
-	cmd := exec.CommandContext(ctx, "mount")
-	output, err := cmd.Output()
+// resourceColumns returns the CPU, MEMORY and PIDS columns of list, with the
+// limits after a slash.
+func resourceColumns(item Workspace) []string {
+	if item.Resources == nil {
+		return []string{"", "", ""}
+	}
+
+	usage := item.Resources
+
+	cpu := usage.CPUTime.Round(100 * time.Millisecond).String()
+	if usage.CPUs > 0 {
+		cpu += fmt.Sprintf("/%g cpus", usage.CPUs)
+	}
+
+	memory := utils.FormatSize(usage.Memory)
+	if usage.MemoryMax > 0 {
+		memory += "/" + utils.FormatSize(usage.MemoryMax)
+	}
+
+	pids := strconv.FormatInt(usage.Pids, 10)
+	if usage.PidsMax > 0 {
+		pids += "/" + strconv.FormatInt(usage.PidsMax, 10)
+	}
+
+	return []string{cpu, memory, pids}
+}
+
+// LookupWorkspace returns the registry entry for name, falling back to the
+// layout derived from config for workspaces that were never recorded.
+func LookupWorkspace(cfg *config.Config, name string) (*registry.Entry, bool, error) {
+	reg, err := registry.Open("")
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
+	if entry, ok := reg.Get(name); ok {
+		return entry, true, nil
+	}
 
-		parts := strings.Fields(line)
-		if len(parts) < 6 {
-			continue
-		}
+	entry := &registry.Entry{
+		Name:  name,
+		Mount: path.Join(utils.ExpandTilde(cfg.Overlay.Mount), name),
+		Sshfs: path.Join(utils.ExpandTilde(cfg.Sshfs.Mount), name),
+	}
+	entry.UpperDir, entry.WorkDir = overlayDirs(entry.Mount)
 
-		onIndex := -1
-		typeIndex := -1
-		for i, part := range parts {
-			if part == "on" {
-				onIndex = i
-			}
-			if part == "type" {
-				typeIndex = i
-				break
+	return entry, false, nil
+}
+
+func getWorkspacesFromRegistry(reg *registry.Registry, mounts []mount.Info, verbose bool) ([]Workspace, map[string]bool) {
+	var workspaces []Workspace
+
+	known := map[string]bool{}
+
+	filesystem := func(mountpoint, fallback string) string {
+		for _, item := range mounts {
+			if item.Mountpoint == mountpoint {
+				return item.FSType
 			}
 		}
+		return fallback
+	}
 
-		if onIndex == -1 || typeIndex == -1 || typeIndex <= onIndex+1 {
+	for _, entry := range reg.List() {
+		created := entry.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		known[entry.Name] = true
+		known[path.Clean(entry.Mount)] = true
+		for _, item := range entry.LowerDirs {
+			known[path.Clean(item)] = true
+		}
+		fstype := filesystem(entry.Mount, "N/A")
+		workspaces = append(workspaces, Workspace{
+			Name:       entry.Name,
+			Mount:      entry.Mount,
+			Filesystem: fstype,
+			Created:    created,
+			Source:     entry.Source,
+			Upper:      entry.UpperDir,
+			Lowers:     entry.LowerDirs,
+			Backend:    entry.Backend,
+			Health:     workspaceHealth(entry, fstype != "N/A"),
+		})
+		if !verbose {
 			continue
 		}
-
-		mountpoint := strings.Join(parts[onIndex+1:typeIndex], " ")
-		filesystem := ""
-		if typeIndex+1 < len(parts) {
-			filesystem = parts[typeIndex+1]
+		for _, item := range entry.LowerDirs {
+			if entry.Sshfs != "" && path.Clean(item) == path.Clean(entry.Sshfs) {
+				continue
+			}
+			workspaces = append(workspaces, Workspace{Mount: item, Filesystem: "lowerdir", Created: created})
+		}
+		for _, item := range [][]string{{entry.UpperDir, "upperdir"}, {entry.WorkDir, "workdir"}} {
+			known[path.Clean(item[0])] = true
+			workspaces = append(workspaces, Workspace{Mount: item[0], Filesystem: item[1], Created: created})
+		}
+		if entry.Sshfs != "" {
+			known[path.Clean(entry.Sshfs)] = true
+			workspaces = append(workspaces, Workspace{Mount: entry.Sshfs, Filesystem: filesystem(entry.Sshfs, "N/A"), Created: created})
 		}
+	}
+
+	return workspaces, known
+}
+
+func getWorkspacesFromMount(mounts []mount.Info, basePath string, verbose bool) []Workspace {
+	var workspaces []Workspace
+
+	for _, item := range mounts {
+		mountpoint := item.Mountpoint
 
 		if strings.HasPrefix(mountpoint, basePath) && mountpoint != basePath {
 			relPath, err := filepath.Rel(basePath, mountpoint)
@@ -200,22 +370,115 @@ func getWorkspacesFromMount(ctx context.Context, basePath string, verbose bool)
 				created := getFilesystemCreatedTime(mountpoint)
 				var name string
 				if verbose {
-					if strings.HasPrefix(relPath, "upper-") || strings.HasPrefix(relPath, "work-") {
+					if isInternalDir(relPath) {
 						name = ""
 					} else {
 						name = relPath
 					}
-					workspaces = append(workspaces, Workspace{name, mountpoint, filesystem, created})
+					workspaces = append(workspaces, mountedWorkspace(item, name, created))
+					if name != "" {
+						workspaces = append(workspaces, getLayersFromMount(item, created)...)
+					}
 				} else {
-					if !strings.HasPrefix(relPath, "upper-") && !strings.HasPrefix(relPath, "work-") {
-						workspaces = append(workspaces, Workspace{relPath, mountpoint, filesystem, created})
+					if !isInternalDir(relPath) {
+						workspaces = append(workspaces, mountedWorkspace(item, relPath, created))
 					}
 				}
 			}
 		}
 	}
 
-	return workspaces, nil
+	return workspaces
+}
+
+// mountedWorkspace describes a workspace found in the mount table only.
+func mountedWorkspace(item mount.Info, name, created string) Workspace {
+	workspace := Workspace{Name: name, Mount: item.Mountpoint, Filesystem: item.FSType, Created: created}
+
+	if name == "" {
+		return workspace
+	}
+
+	workspace.Upper, _ = item.SuperOption("upperdir")
+	workspace.Lowers = mountLowers(item)
+	workspace.Health = healthOK
+
+	switch {
+	case item.FSType == "overlay":
+		workspace.Backend = overlay.BackendKernel
+	case strings.HasSuffix(item.FSType, "fuse-overlayfs"):
+		workspace.Backend = overlay.BackendFuse
+	}
+
+	return workspace
+}
+
+// workspaceHealth tells whether a recorded workspace is mounted and still has
+// all of its layers.
+func workspaceHealth(entry *registry.Entry, mounted bool) string {
+	for _, dir := range append([]string{entry.UpperDir, entry.WorkDir}, entry.LowerDirs...) {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return healthBroken
+		}
+	}
+
+	if !mounted {
+		return healthUnmounted
+	}
+
+	return healthOK
+}
+
+// getLayersFromMount returns the layers an overlay was mounted with, for
+// workspaces that were never recorded in the registry.
+func getLayersFromMount(item mount.Info, created string) []Workspace {
+	var workspaces []Workspace
+
+	for _, lower := range mountLowers(item) {
+		workspaces = append(workspaces, Workspace{Mount: lower, Filesystem: "lowerdir", Created: created})
+	}
+
+	for _, key := range []string{"upperdir", "workdir"} {
+		if dir, ok := item.SuperOption(key); ok {
+			workspaces = append(workspaces, Workspace{Mount: dir, Filesystem: key, Created: created})
+		}
+	}
+
+	return workspaces
+}
+
+// mountLowers returns the lower layers of an overlay mount, top first. Data
+// only layers after "::" are listed with the others.
+func mountLowers(item mount.Info) []string {
+	var lowers []string
+
+	value, _ := item.SuperOption("lowerdir")
+	for _, lower := range strings.Split(value, ":") {
+		if lower != "" {
+			lowers = append(lowers, lower)
+		}
+	}
+
+	return lowers
+}
+
+func isLayerRow(item Workspace) bool {
+	return item.Name == "" && (item.Filesystem == "lowerdir" || item.Filesystem == "upperdir" || item.Filesystem == "workdir")
+}
+
+// isInternalDir reports whether a directory next to the overlay mounts holds
+// layers of a workspace rather than a workspace mount.
+func isInternalDir(name string) bool {
+	for _, prefix := range []string{"upper-", "work-", "lower-"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func getWorkspacesFromFilesystem(overlayPath string, cfg *config.Config, verbose bool) ([]Workspace, error) {
@@ -232,15 +495,15 @@ func getWorkspacesFromFilesystem(overlayPath string, cfg *config.Config, verbose
 					created := getFilesystemCreatedTime(p)
 					var name string
 					if verbose {
-						if strings.HasPrefix(relPath, "upper-") || strings.HasPrefix(relPath, "work-") {
+						if isInternalDir(relPath) {
 							name = ""
 						} else {
 							name = relPath
 						}
-						workspaces = append(workspaces, Workspace{name, p, "overlay", created})
+						workspaces = append(workspaces, Workspace{Name: name, Mount: p, Filesystem: "overlay", Created: created, Health: healthUnknown})
 					} else {
-						if !strings.HasPrefix(relPath, "upper-") && !strings.HasPrefix(relPath, "work-") {
-							workspaces = append(workspaces, Workspace{relPath, p, "overlay", created})
+						if !isInternalDir(relPath) {
+							workspaces = append(workspaces, Workspace{Name: relPath, Mount: p, Filesystem: "overlay", Created: created, Health: healthUnknown})
 						}
 					}
 				}
@@ -270,7 +533,7 @@ func getSshfsWorkspacesFromFilesystem(sshfsPath string) []Workspace {
 			if d.IsDir() {
 				if p != sshfsPath {
 					created := getFilesystemCreatedTime(p)
-					workspaces = append(workspaces, Workspace{"", p, "sshfs", created})
+					workspaces = append(workspaces, Workspace{Mount: p, Filesystem: "sshfs", Created: created})
 				}
 			}
 		}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mcp"
+	"github.com/repo-scm/git/sandbox"
+	"github.com/repo-scm/git/tools"
+)
+
+var (
+	mcpHostCommands bool
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "MCP server for workspace",
+	Args:  cobra.RangeArgs(1, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		name := args[0]
+		if err := runMcp(ctx, config, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(mcpCmd)
+
+	mcpCmd.Flags().BoolVarP(&mcpHostCommands, "host-commands", "H", false, "offer run_command without a sandbox, running on the host")
+
+	mcpCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <workspace_name> [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git mcp your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git mcp your_workspace --host-commands\n")
+		return nil
+	})
+}
+
+func runMcp(ctx context.Context, cfg *config.Config, name string) error {
+	entry, _, err := LookupWorkspace(cfg, name)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(entry.Mount); err != nil || !info.IsDir() {
+		return fmt.Errorf("workspace %s not found at %s", name, entry.Mount)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// stdout carries the protocol, so diagnostics must go to stderr
+	_, _ = fmt.Fprintf(os.Stderr, "serving MCP for workspace %s at %s\n", name, entry.Mount)
+
+	server := mcp.NewServer(entry.Mount, rootCmd.Version)
+
+	// Commands of the client can only be kept inside the workspace by a sandbox
+	switch err := sandbox.Available(); {
+	case err == nil:
+		server.Tools = tools.Sandboxed(server.Tools)
+	case mcpHostCommands:
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %v, run_command runs on the host and can write anywhere you can\n", err)
+	default:
+		server.Tools = withoutTool(server.Tools, "run_command")
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %v, run_command left out, use --host-commands to offer it anyway\n", err)
+	}
+
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// withoutTool returns list without the tool called name.
+func withoutTool(list []tools.Tool, name string) []tools.Tool {
+	var out []tools.Tool
+
+	for _, item := range list {
+		if item.Name != name {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,195 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/recording"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	recordingsDirName = "recordings"
+)
+
+var (
+	replayIdle  time.Duration
+	replayList  bool
+	replaySpeed float64
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay recorded workspace session",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var session string
+		ctx := context.Background()
+		config := GetConfig()
+		if len(args) == 2 {
+			session = args[1]
+		}
+		if err := runReplay(ctx, config, args[0], session); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	replayCmd.Flags().DurationVarP(&replayIdle, "idle", "i", 2*time.Second, "cut pauses to this long, 0 keeps them")
+	replayCmd.Flags().BoolVarP(&replayList, "list", "l", false, "list sessions, or the commands of a session")
+	replayCmd.Flags().Float64VarP(&replaySpeed, "speed", "s", 1, "play this many times as fast")
+
+	replayCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <workspace_name> [session] [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git replay your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git replay your_workspace --list\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git replay your_workspace your_session --list\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git replay your_workspace your_session --speed 2\n")
+		return nil
+	})
+}
+
+func runReplay(ctx context.Context, _ *config.Config, name, session string) error {
+	if replaySpeed <= 0 {
+		return errors.Errorf("invalid speed %g\n", replaySpeed)
+	}
+
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	dir := recordingsDir(reg, name)
+
+	if replayList && session == "" {
+		return listRecordings(ctx, dir)
+	}
+
+	var rec *recording.Recording
+
+	if session != "" {
+		if rec, err = recording.Load(dir, session); err != nil {
+			return err
+		}
+	} else {
+		list, err := recording.List(dir)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return errors.Errorf("no recorded sessions of workspace %s, record one with 'git run --record %s'\n", name, name)
+		}
+		rec = list[0]
+	}
+
+	if replayList {
+		return listCommands(ctx, rec)
+	}
+
+	// Stop playing on Ctrl-C, without leaving the terminal in an odd state
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = rec.Play(ctx, os.Stdout, replaySpeed, replayIdle)
+
+	// Reset colors the session may have left set
+	fmt.Print("\x1b[0m\n")
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+func listRecordings(ctx context.Context, dir string) error {
+	list, err := recording.List(dir)
+	if err != nil {
+		return err
+	}
+
+	data := [][]string{
+		{"SESSION", "STARTED", "DURATION", "COMMANDS"},
+	}
+
+	for _, item := range list {
+		data = append(data, []string{
+			item.ID,
+			item.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			item.Duration.Round(time.Second).String(),
+			strconv.Itoa(item.Commands),
+		})
+	}
+
+	return utils.WriteTable(ctx, data)
+}
+
+func listCommands(ctx context.Context, rec *recording.Recording) error {
+	commands, err := rec.ReadCommands()
+	if err != nil {
+		return err
+	}
+
+	data := [][]string{
+		{"TIME", "OFFSET", "COMMAND"},
+	}
+
+	for _, item := range commands {
+		offset := item.Time.Sub(rec.StartedAt)
+		if offset < 0 {
+			offset = 0
+		}
+		data = append(data, []string{
+			item.Time.Local().Format("2006-01-02 15:04:05"),
+			offset.String(),
+			item.Line,
+		})
+	}
+
+	return utils.WriteTable(ctx, data)
+}
+
+func recordingsDir(reg *registry.Registry, name string) string {
+	return path.Join(reg.StateDir(name), recordingsDirName)
+}
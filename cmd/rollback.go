@@ -0,0 +1,117 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
+)
+
+var (
+	rollbackForce bool
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Rollback workspace to snapshot",
+	Args:  cobra.RangeArgs(2, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config := GetConfig()
+		name := args[0]
+		label := args[1]
+		if err := runRollback(ctx, config, name, label); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+
+	rollbackCmd.Flags().BoolVarP(&rollbackForce, "force", "f", false, "detach overlay even when busy")
+
+	rollbackCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <workspace_name> <label> [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git rollback your_workspace before-refactor\n")
+		return nil
+	})
+}
+
+func runRollback(ctx context.Context, _ *config.Config, name, label string) error {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	entry, ok := reg.Get(name)
+	if !ok {
+		return errors.Errorf("workspace %s not found\n", name)
+	}
+
+	if err := validateLabel(label); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path.Join(reg.StateDir(name), snapshotDir, label+snapshotExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("snapshot %s not found, run 'git snapshot %s --list' to show snapshots\n", label, name)
+		}
+		return errors.Wrap(err, "failed to open snapshot\n")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	err = withDetachedOverlay(ctx, entry, &rollbackForce, func() error {
+		if err := overlay.Extract(file, entry.UpperDir); err != nil {
+			return errors.Wrap(err, "failed to restore snapshot\n")
+		}
+		// Work dir state belongs to the upper layer that was just replaced
+		_ = os.RemoveAll(entry.WorkDir)
+		return os.MkdirAll(entry.WorkDir, 0755)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("rolled back workspace %s to snapshot %s\n", name, label)
+
+	return nil
+}
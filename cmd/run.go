@@ -8,14 +8,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path"
-	"strings"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
 	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/recording"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/sandbox"
 	"github.com/repo-scm/git/utils"
 )
 
@@ -35,6 +37,15 @@ const (
 	runPS1 = `\[\033[0;32m\]git@repo-scm ➜ \[\033[01;34m\]%s \[\033[00m\]\$ `
 )
 
+var (
+	runSandbox   bool
+	runNoNetwork bool
+	runCpus      float64
+	runMemory    string
+	runPids      int64
+	runRecord    bool
+)
+
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run workspace",
@@ -66,6 +77,13 @@ var runCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(runCmd)
 
+	runCmd.Flags().BoolVarP(&runSandbox, "sandbox", "s", false, "run in namespaces with only the workspace writable")
+	runCmd.Flags().BoolVarP(&runNoNetwork, "no-network", "n", false, "cut the sandbox off the network")
+	runCmd.Flags().Float64VarP(&runCpus, "cpus", "C", 0, "limit CPUs of the session like 1.5, overrides limits.cpus")
+	runCmd.Flags().StringVarP(&runMemory, "memory", "m", "", "limit memory of the session like 4G, overrides limits.memory")
+	runCmd.Flags().BoolVarP(&runRecord, "record", "r", false, "record the session for git replay")
+	runCmd.Flags().Int64VarP(&runPids, "pids", "p", 0, "limit processes of the session, overrides limits.pids")
+
 	runCmd.SetUsageFunc(func(cmd *cobra.Command) error {
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s [workspace_name] [flags]\n\n", cmd.Root().Name(), cmd.Name())
@@ -92,33 +110,96 @@ func init() {
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git run your_workspace\n")
 		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git run # Interactive workspace selection\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git run --sandbox --no-network your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git run --cpus 2 --memory 4G your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git run --record your_workspace\n")
 		return nil
 	})
 }
 
 func runRun(_ context.Context, cfg *config.Config, name string) error {
-	content := fmt.Sprintf(`export PS1="%s"`, fmt.Sprintf(runPS1, name))
-	if err := appendContentToBashrc(content); err != nil {
+	if runNoNetwork && !runSandbox {
+		return errors.New("--no-network requires --sandbox")
+	}
+
+	limits, err := sessionLimits(cfg, runCpus, runMemory, runPids)
+	if err != nil {
 		return err
 	}
 
-	defer func(content string) {
-		_ = removeContentFromBashrc(content)
-	}(content)
+	entry, registered, err := LookupWorkspace(cfg, name)
+	if err != nil {
+		return err
+	}
 
-	mount := path.Join(utils.ExpandTilde(cfg.Overlay.Mount), name)
-	script := fmt.Sprintf(`
-echo '%s'
-exec bash
-`, fmt.Sprintf(runWelcome, mount))
+	mountPath := entry.Mount
+	if _, err := os.Stat(mountPath); err != nil {
+		return fmt.Errorf("workspace %s not found at %s", name, mountPath)
+	}
 
-	cmd := exec.Command("/bin/bash", "-c", script)
-	cmd.Dir = mount
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// The mount point of a workspace is empty until it is mounted again
+	if mounted, err := mount.IsMounted(mountPath); registered && err == nil && !mounted {
+		return fmt.Errorf("workspace %s is not mounted, run '%s up %s' first", name, rootCmd.Use, name)
+	}
 
-	if err := cmd.Run(); err != nil {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	var tmp string
+
+	// The sandbox has a /tmp of its own, so the rcfile goes to the state of
+	// the workspace, which stays readable
+	if runSandbox {
+		tmp = reg.StateDir(name)
+		if err := os.MkdirAll(tmp, utils.PermDir); err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+	}
+
+	cmd, cleanup, err := shellCommand(name, mountPath, tmp, runRecord)
+	if err != nil {
+		return err
+	}
+
+	defer cleanup()
+
+	var rec *recording.Recording
+
+	if runRecord {
+		if rec, err = recording.Create(recordingsDir(reg, name), name); err != nil {
+			return err
+		}
+		defer func() {
+			_ = rec.Index.Close()
+		}()
+		cmd.ExtraFiles = []*os.File{rec.Index}
+	}
+
+	if runSandbox {
+		if err := sandbox.Wrap(cmd, sandbox.Options{Writable: mountPath, NoNetwork: runNoNetwork}); err != nil {
+			return err
+		}
+	}
+
+	defer limitSession(cmd, name, limits)()
+
+	fmt.Printf(runWelcome, mountPath)
+
+	if rec != nil {
+		err = rec.Run(cmd)
+	} else {
+		err = cmd.Run()
+	}
+
+	// The shell exits with the status of the last command, which is recorded anyway
+	var exitErr *exec.ExitError
+	if rec != nil && (err == nil || errors.As(err, &exitErr)) {
+		fmt.Printf("\n📼 Session recorded, replay it with \"git replay %s %s\"\n", name, rec.ID)
+	}
+
+	if err != nil {
 		return err
 	}
 
@@ -177,38 +258,3 @@ func selectWorkspaceInteractively(ctx context.Context, cfg *config.Config) (stri
 
 	return result, nil
 }
-
-func appendContentToBashrc(content string) error {
-	file, err := os.OpenFile(os.ExpandEnv("$HOME/.bashrc"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, utils.PermFile)
-	if err != nil {
-		return fmt.Errorf("failed to open bashrc file: %w", err)
-	}
-
-	defer func(file *os.File) {
-		_ = file.Close()
-	}(file)
-
-	if _, err := file.WriteString(content); err != nil {
-		return fmt.Errorf("failed to write bashrc file: %w", err)
-	}
-
-	return nil
-}
-
-func removeContentFromBashrc(content string) error {
-	file := os.ExpandEnv("$HOME/.bashrc")
-
-	old, err := os.ReadFile(file)
-	if err != nil {
-		return fmt.Errorf("failed to read bashrc file: %w", err)
-	}
-
-	_new := strings.ReplaceAll(string(old), content, "")
-	if string(old) != _new {
-		if err = os.WriteFile(file, []byte(_new), utils.PermFile); err != nil {
-			return fmt.Errorf("failed to write bashrc file: %w", err)
-		}
-	}
-
-	return nil
-}
@@ -0,0 +1,163 @@
+//go:build linux
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	zshPrompt  = `%%F{green}git@repo-scm ➜ %%F{blue}%s %%f%%# `
+	fishPrompt = `function fish_prompt; set_color green; echo -n 'git@repo-scm ➜ '; set_color blue; echo -n %s; set_color normal; echo -n ' $ '; end`
+)
+
+// The hooks write each command entered to fd 3, the first of ExtraFiles, as
+// its Unix time, a tab and the command on one line. bash only knows a command
+// once it finished, so its hook reads the history, which every command has to
+// go to.
+const (
+	bashIndex = `HISTCONTROL= HISTIGNORE=
+__repo_scm_index=
+__repo_scm_log() {
+  local re='^ *([0-9]+)\*? +([0-9]+) (.*)$' n=0 t= c=
+  if [[ $(HISTTIMEFORMAT='%s ' builtin history 1) =~ $re ]]; then
+    n=${BASH_REMATCH[1]} t=${BASH_REMATCH[2]} c=${BASH_REMATCH[3]}
+  fi
+  if [[ -n $__repo_scm_index && $n != "$__repo_scm_index" ]]; then
+    printf '%s\t%s\n' "$t" "${c//$'\n'/ }" >&3
+  fi
+  __repo_scm_index=$n
+}
+PROMPT_COMMAND="__repo_scm_log${PROMPT_COMMAND:+; $PROMPT_COMMAND}"`
+
+	zshIndex = `zmodload zsh/datetime
+__repo_scm_log() { print -r -- "$EPOCHSECONDS"$'\t'"${1//$'\n'/ }" >&3 }
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __repo_scm_log`
+
+	fishIndex = `function __repo_scm_log --on-event fish_preexec; printf '%s\t%s\n' (date +%s) (string join ' ' -- (string split \n -- $argv[1])) >&3; end`
+)
+
+// shellCommand returns an interactive shell in dir showing the workspace in
+// its prompt, picked from $SHELL among bash, zsh and fish. The prompt is set
+// from a per-session rcfile that loads the user's own one first, so the
+// user's files are never touched. The rcfile goes to a temporary directory in
+// tmp, or the default one if tmp is empty. With index, the shell logs the
+// commands entered to fd 3. cleanup removes the rcfile.
+func shellCommand(name, dir, tmp string, index bool) (cmd *exec.Cmd, cleanup func(), err error) {
+	cleanup = func() {}
+
+	shell := os.Getenv("SHELL")
+	if _, err := exec.LookPath(shell); shell == "" || err != nil {
+		shell = "bash"
+	}
+
+	switch path.Base(shell) {
+	case "fish":
+		args := []string{"--interactive", "--init-command", fmt.Sprintf(fishPrompt, shellQuote(name))}
+		if index {
+			args = append(args, "--init-command", fishIndex)
+		}
+		cmd = exec.Command(shell, args...)
+	case "zsh":
+		if cmd, cleanup, err = zshCommand(shell, name, tmp, index); err != nil {
+			return nil, nil, err
+		}
+	default:
+		if cmd, cleanup, err = bashCommand(name, tmp, index); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd, cleanup, nil
+}
+
+func bashCommand(name, tmp string, index bool) (*exec.Cmd, func(), error) {
+	lines := []string{
+		`[ -f "$HOME/.bashrc" ] && . "$HOME/.bashrc"`,
+		"PS1=" + shellQuote(fmt.Sprintf(runPS1, name)),
+	}
+
+	if index {
+		lines = append(lines, bashIndex)
+	}
+
+	rc := strings.Join(append(lines, ""), "\n")
+
+	dir, err := writeRcfile(tmp, ".bashrc", rc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command("bash", "--rcfile", path.Join(dir, ".bashrc"), "-i")
+
+	return cmd, func() { _ = os.RemoveAll(dir) }, nil
+}
+
+// zshCommand points ZDOTDIR at a directory whose startup files load the
+// user's ones from the real ZDOTDIR, then restore it and set the prompt.
+func zshCommand(shell, name, tmp string, index bool) (*exec.Cmd, func(), error) {
+	home := os.Getenv("ZDOTDIR")
+	if home == "" {
+		home = os.Getenv("HOME")
+	}
+
+	env := fmt.Sprintf(`[ -f %[1]s/.zshenv ] && . %[1]s/.zshenv`+"\n", shellQuote(home))
+
+	lines := []string{
+		"ZDOTDIR=" + shellQuote(home),
+		`[ -f "$ZDOTDIR/.zshrc" ] && . "$ZDOTDIR/.zshrc"`,
+		"PROMPT=" + shellQuote(fmt.Sprintf(zshPrompt, strings.ReplaceAll(name, "%", "%%"))),
+	}
+
+	if index {
+		lines = append(lines, zshIndex)
+	}
+
+	rc := strings.Join(append(lines, ""), "\n")
+
+	dir, err := writeRcfile(tmp, ".zshenv", env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.WriteFile(path.Join(dir, ".zshrc"), []byte(rc), utils.PermFile); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("failed to write zshrc file: %w", err)
+	}
+
+	cmd := exec.Command(shell, "-i")
+	cmd.Env = append(os.Environ(), "ZDOTDIR="+dir)
+
+	return cmd, func() { _ = os.RemoveAll(dir) }, nil
+}
+
+func writeRcfile(tmp, name, content string) (string, error) {
+	dir, err := os.MkdirTemp(tmp, "repo-scm-run-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create rcfile: %w", err)
+	}
+
+	if err := os.WriteFile(path.Join(dir, name), []byte(content), utils.PermFile); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to write rcfile: %w", err)
+	}
+
+	return dir, nil
+}
+
+// shellQuote quotes s for bash, zsh and fish alike.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
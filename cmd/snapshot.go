@@ -0,0 +1,266 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/mount"
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/registry"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	snapshotDir = "snapshots"
+	snapshotExt = ".tar.gz"
+)
+
+var (
+	snapshotForce bool
+	snapshotList  bool
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Snapshot upper layer of workspace",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var label string
+		ctx := context.Background()
+		config := GetConfig()
+		name := args[0]
+		if len(args) == 2 {
+			label = args[1]
+		}
+		if err := runSnapshot(ctx, config, name, label); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+
+	snapshotCmd.Flags().BoolVarP(&snapshotForce, "force", "f", false, "detach overlay even when busy")
+	snapshotCmd.Flags().BoolVarP(&snapshotList, "list", "l", false, "list snapshots of workspace")
+
+	snapshotCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s <workspace_name> [label] [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git snapshot your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git snapshot your_workspace before-refactor\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git snapshot your_workspace --list\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git snapshot your_workspace --force\n")
+		return nil
+	})
+}
+
+func runSnapshot(ctx context.Context, _ *config.Config, name, label string) error {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	entry, ok := reg.Get(name)
+	if !ok {
+		return errors.Errorf("workspace %s not found\n", name)
+	}
+
+	dir := path.Join(reg.StateDir(name), snapshotDir)
+
+	if snapshotList {
+		return listSnapshots(ctx, dir)
+	}
+
+	if label == "" {
+		label = time.Now().Format("20060102-150405")
+	}
+
+	if err := validateLabel(label); err != nil {
+		return err
+	}
+
+	file := path.Join(dir, label+snapshotExt)
+
+	if _, err := os.Stat(file); err == nil {
+		return errors.Errorf("snapshot %s already exists\n", label)
+	}
+
+	if err := os.MkdirAll(dir, utils.PermDir); err != nil {
+		return errors.Wrap(err, "failed to create snapshot directory\n")
+	}
+
+	err = withDetachedOverlay(ctx, entry, &snapshotForce, func() error {
+		return writeSnapshot(file, entry.UpperDir)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created snapshot %s of workspace %s\n", label, name)
+
+	return nil
+}
+
+// withDetachedOverlay runs fn while the overlay is unmounted, so the upper
+// layer is not changed underneath it, and mounts the overlay again after. A
+// busy overlay is refused, since detaching it lazily keeps it writing to the
+// upper layer, unless force is set: then it is detached lazily and left
+// unmounted until its users are gone. Commands without a --force flag for
+// this pass nil.
+func withDetachedOverlay(ctx context.Context, entry *registry.Entry, force *bool, fn func() error) error {
+	mounted, err := mount.IsMounted(entry.Mount)
+	if err != nil {
+		return errors.Wrap(err, "failed to read mount table\n")
+	}
+
+	remount := mounted
+
+	if mounted {
+		err := mount.UnmountStrict(ctx, entry.Mount)
+		switch {
+		case errors.Is(err, mount.ErrBusy) && force == nil:
+			return errors.Errorf("workspace %s busy%s, close it first\n", entry.Name, busyUsers(entry.Mount))
+		case errors.Is(err, mount.ErrBusy) && !*force:
+			return errors.Errorf("workspace %s busy%s, close it or retry with --force\n", entry.Name, busyUsers(entry.Mount))
+		case errors.Is(err, mount.ErrBusy):
+			users := busyUsers(entry.Mount)
+			if err := mount.Unmount(ctx, entry.Mount); err != nil {
+				return errors.Wrap(err, "failed to unmount overlay\n")
+			}
+			// Mounting the same upper layer twice corrupts it
+			remount = false
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: workspace %s detached while in use%s, run 'git up %s' once they exit\n",
+				entry.Name, users, entry.Name)
+		case err != nil:
+			return errors.Wrap(err, "failed to unmount overlay\n")
+		}
+	}
+
+	fnErr := fn()
+
+	if remount {
+		if err := mountWorkspace(ctx, entry); err != nil {
+			return errors.Wrapf(err, "failed to mount overlay again, run 'git up %s' after fixing it\n", entry.Name)
+		}
+	}
+
+	return fnErr
+}
+
+// busyUsers describes the processes keeping target busy, if any are found.
+func busyUsers(target string) string {
+	pids, err := mount.Users(target)
+	if err != nil || len(pids) == 0 {
+		return ""
+	}
+
+	var items []string
+	for _, pid := range pids {
+		items = append(items, strconv.Itoa(pid))
+	}
+
+	return " (used by pid " + strings.Join(items, ", ") + ")"
+}
+
+func writeSnapshot(name, upper string) error {
+	tmp := name + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, utils.PermFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to create snapshot\n")
+	}
+
+	if err := overlay.Archive(file, upper); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "failed to create snapshot\n")
+	}
+
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "failed to create snapshot\n")
+	}
+
+	return os.Rename(tmp, name)
+}
+
+func listSnapshots(ctx context.Context, dir string) error {
+	data := [][]string{
+		{"LABEL", "SIZE", "CREATED"},
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to read snapshot directory\n")
+	}
+
+	var infos []os.FileInfo
+
+	for _, item := range entries {
+		if !strings.HasSuffix(item.Name(), snapshotExt) {
+			continue
+		}
+		if info, err := item.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		data = append(data, []string{
+			strings.TrimSuffix(info.Name(), snapshotExt),
+			fmt.Sprintf("%d", info.Size()),
+			info.ModTime().Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return utils.WriteTable(ctx, data)
+}
+
+func validateLabel(label string) error {
+	if label == "." || label == ".." || strings.ContainsAny(label, "/\x00") {
+		return errors.Errorf("invalid snapshot label %s\n", label)
+	}
+
+	return nil
+}
@@ -3,62 +3,139 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/repo-scm/git/overlay"
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	statusOK            = "ok"
+	statusMissing       = "missing"
+	statusNotExecutable = "not executable"
+	statusUnsupported   = "unsupported"
 )
 
+var (
+	statusFormat string
+	statusOutput string
+)
+
+// Component is a dependency checked by status.
+type Component struct {
+	Name   string `json:"name" yaml:"name"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show install status",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		_ = checkOverlayfs()
-		_ = checkSshfs()
-		return nil
+		ctx := context.Background()
+		if err := utils.ValidateOutput(statusOutput, statusFormat); err != nil {
+			return err
+		}
+		components := []Component{checkOverlayfs(), checkKernelOverlay(), checkSshfs()}
+		return utils.WriteOutput(ctx, statusOutput, statusFormat, components, func(wide bool) error {
+			if wide {
+				return writeStatusTable(ctx, components)
+			}
+			writeStatus(components)
+			return nil
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringVarP(&statusFormat, "format", "f", "", "print each component with a Go template")
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", utils.OutputTable, "output format (table, wide, json or yaml)")
 }
 
-func checkOverlayfs() error {
+func checkOverlayfs() Component {
 	targetPath := "/usr/local/bin/fuse-overlayfs"
 
-	fmt.Printf("fuse-overlayfs:\n")
+	return checkBinary("fuse-overlayfs", targetPath, fmt.Sprintf("Run 'sudo %s install' to install", rootCmd.Use))
+}
+
+func checkKernelOverlay() Component {
+	component := Component{Name: "kernel overlayfs", Status: statusOK}
+
+	if err := (overlay.Kernel{}).Available(); err != nil {
+		component.Status = statusUnsupported
+		component.Detail = err.Error()
+	}
+
+	return component
+}
+
+func checkSshfs() Component {
+	sshfsPath := "/usr/bin/sshfs"
+
+	return checkBinary("sshfs", sshfsPath, "Run 'sudo apt install sshfs' to install")
+}
+
+func checkBinary(name, targetPath, hint string) Component {
+	component := Component{Name: name, Path: targetPath, Status: statusOK}
 
 	if info, err := os.Stat(targetPath); err == nil {
-		fmt.Printf("  Installed: ✓ %s\n", targetPath)
-		if info.Mode()&0111 != 0 {
-			fmt.Printf("  Executable: ✓\n")
-		} else {
-			fmt.Printf("  Executable: ✗ (not executable)\n")
+		if info.Mode()&0111 == 0 {
+			component.Status = statusNotExecutable
 		}
 	} else {
-		fmt.Printf("  Installed: ✗ (not found at %s)\n", targetPath)
-		fmt.Printf("  Run 'sudo %s install' to install\n", rootCmd.Use)
+		component.Status = statusMissing
+		component.Detail = fmt.Sprintf("not found at %s", targetPath)
+		component.Hint = hint
 	}
 
-	return nil
+	return component
 }
 
-func checkSshfs() error {
-	sshfsPath := "/usr/bin/sshfs"
+func writeStatus(components []Component) {
+	for i, item := range components {
+		if i > 0 {
+			fmt.Printf("\n")
+		}
+		fmt.Printf("%s:\n", item.Name)
+		switch {
+		case item.Path == "" && item.Status == statusOK:
+			fmt.Printf("  Supported: ✓\n")
+		case item.Path == "":
+			fmt.Printf("  Supported: ✗ (%s)\n", item.Detail)
+		case item.Status == statusMissing:
+			fmt.Printf("  Installed: ✗ (%s)\n", item.Detail)
+			fmt.Printf("  %s\n", item.Hint)
+		default:
+			fmt.Printf("  Installed: ✓ %s\n", item.Path)
+			if item.Status == statusOK {
+				fmt.Printf("  Executable: ✓\n")
+			} else {
+				fmt.Printf("  Executable: ✗ (not executable)\n")
+			}
+		}
+	}
+}
 
-	fmt.Printf("\nsshfs:\n")
+func writeStatusTable(ctx context.Context, components []Component) error {
+	data := [][]string{
+		{"NAME", "PATH", "STATUS", "DETAIL"},
+	}
 
-	if info, err := os.Stat(sshfsPath); err == nil {
-		fmt.Printf("  Installed: ✓ %s\n", sshfsPath)
-		if info.Mode()&0111 != 0 {
-			fmt.Printf("  Executable: ✓\n")
-		} else {
-			fmt.Printf("  Executable: ✗ (not executable)\n")
+	for _, item := range components {
+		detail := item.Detail
+		if item.Hint != "" {
+			detail += ", " + item.Hint
 		}
-	} else {
-		fmt.Printf("  Installed: ✗ (not found at %s)\n", sshfsPath)
-		fmt.Printf("  Run 'sudo apt install sshfs' to install\n")
+		data = append(data, []string{item.Name, item.Path, item.Status, detail})
 	}
 
-	return nil
+	return utils.WriteTable(ctx, data)
 }
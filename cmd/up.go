@@ -0,0 +1,124 @@
+//go:build linux
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/repo-scm/git/config"
+	"github.com/repo-scm/git/registry"
+)
+
+var upCmd = &cobra.Command{
+	Use:     "up",
+	Aliases: []string{"resume"},
+	Short:   "Mount workspace again",
+	Args:    cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var name string
+		ctx := context.Background()
+		config := GetConfig()
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if err := runUp(ctx, config, name); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// nolint:gochecknoinits
+func init() {
+	rootCmd.AddCommand(upCmd)
+
+	upCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Usage:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  %s %s [workspace_name] [flags]\n\n", cmd.Root().Name(), cmd.Name())
+		if cmd.HasLocalFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "Flags:\n")
+			cmd.LocalFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.Name != "help" && flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		if cmd.HasInheritedFlags() {
+			_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nGlobal Flags:\n")
+			cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  -%s, --%s   %s", flag.Shorthand, flag.Name, flag.Usage)
+				if flag.DefValue != "" {
+					_, _ = fmt.Fprintf(cmd.OutOrStderr(), " (default %s)", flag.DefValue)
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\n")
+			})
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "\nExample:\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git up your_workspace\n")
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), "  git up\n")
+		return nil
+	})
+}
+
+func runUp(ctx context.Context, cfg *config.Config, name string) error {
+	reg, err := registry.Open("")
+	if err != nil {
+		return err
+	}
+
+	if name != "" {
+		entry, ok := reg.Get(name)
+		if !ok {
+			return errors.Errorf("workspace %s not found\n", name)
+		}
+		return resumeWorkspace(ctx, reg, cfg, entry)
+	}
+
+	var failed []string
+
+	for _, entry := range reg.List() {
+		if err := resumeWorkspace(ctx, reg, cfg, entry); err != nil {
+			fmt.Println(strings.TrimSpace(err.Error()))
+			failed = append(failed, entry.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("failed to mount workspace(s) %s\n", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// resumeWorkspace mounts the sshfs and overlay of a recorded workspace again,
+// such as after a reboot, on top of the upper layer it already has.
+func resumeWorkspace(ctx context.Context, reg *registry.Registry, cfg *config.Config, entry *registry.Entry) error {
+	problems := diagnoseWorkspace(reg, cfg, entry)
+
+	if len(problems) == 0 {
+		fmt.Printf("workspace %s is already up\n", entry.Name)
+		return nil
+	}
+
+	for _, item := range problems {
+		if item.fix == nil {
+			return errors.Errorf("workspace %s: %s, see 'git doctor %s'\n", entry.Name, item.detail, entry.Name)
+		}
+		if err := item.fix(ctx); err != nil {
+			return errors.Wrapf(err, "workspace %s: %s\n", entry.Name, item.detail)
+		}
+	}
+
+	fmt.Printf("workspace %s is up at %s\n", entry.Name, entry.Mount)
+
+	return nil
+}
@@ -18,9 +18,16 @@ import (
 var configData string
 
 type Config struct {
+	Chat    Chat    `yaml:"chat"`
 	Models  []Model `yaml:"models"`
 	Overlay Overlay `yaml:"overlay"`
 	Sshfs   Sshfs   `yaml:"sshfs"`
+	Limits  Limits  `yaml:"limits"`
+}
+
+type Chat struct {
+	HistoryBudget int `yaml:"history_budget"`
+	ContextBudget int `yaml:"context_budget"`
 }
 
 type Model struct {
@@ -31,7 +38,15 @@ type Model struct {
 }
 
 type Overlay struct {
-	Mount string `yaml:"mount"`
+	Backend string   `yaml:"backend"`
+	Mount   string   `yaml:"mount"`
+	Layers  []string `yaml:"layers"`
+}
+
+type Limits struct {
+	Cpus   float64 `yaml:"cpus"`
+	Memory string  `yaml:"memory"`
+	Pids   int64   `yaml:"pids"`
 }
 
 type Sshfs struct {
@@ -3,9 +3,23 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/repo-scm/git/cmd"
+	"github.com/repo-scm/git/sandbox"
 )
 
 func main() {
+	// Sandboxed commands are started through this binary
+	if sandbox.IsInit() {
+		code, err := sandbox.Init()
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		os.Exit(code)
+	}
+
 	cmd.Execute()
 }
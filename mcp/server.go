@@ -0,0 +1,242 @@
+//go:build linux
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/tools"
+)
+
+const (
+	jsonrpcVersion  = "2.0"
+	protocolVersion = "2025-06-18"
+
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+var supportedVersions = []string{
+	"2024-11-05",
+	"2025-03-26",
+	"2025-06-18",
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Server speaks MCP over newline-delimited JSON-RPC 2.0 and runs every tool
+// against a single workspace root.
+type Server struct {
+	Name    string
+	Version string
+	Root    string
+	Tools   []tools.Tool
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewServer(root, version string) *Server {
+	return &Server{
+		Name:    "repo-scm-git",
+		Version: version,
+		Root:    root,
+		Tools:   tools.Builtin(),
+	}
+}
+
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+
+	reader := bufio.NewReader(r)
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			s.handle(ctx, line)
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, line []byte) {
+	var req request
+
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.reply(nil, nil, &rpcError{codeParseError, "parse error"})
+		return
+	}
+
+	if req.JSONRPC != jsonrpcVersion || req.Method == "" {
+		s.reply(req.ID, nil, &rpcError{codeInvalidRequest, "invalid request"})
+		return
+	}
+
+	result, rpcErr := s.dispatch(ctx, &req)
+
+	// Notifications carry no id and never get a response
+	if len(req.ID) == 0 {
+		return
+	}
+
+	s.reply(req.ID, result, rpcErr)
+}
+
+func (s *Server) dispatch(ctx context.Context, req *request) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return s.listTools(), nil
+	case "tools/call":
+		return s.callTool(ctx, req.Params)
+	default:
+		if len(req.ID) == 0 {
+			// Unknown notifications such as notifications/initialized are ignored
+			return nil, nil
+		}
+		return nil, &rpcError{codeMethodNotFound, "method not found: " + req.Method}
+	}
+}
+
+func (s *Server) initialize(params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+	}
+
+	version := protocolVersion
+	for _, item := range supportedVersions {
+		if item == p.ProtocolVersion {
+			version = item
+		}
+	}
+
+	return map[string]any{
+		"protocolVersion": version,
+		"capabilities": map[string]any{
+			"tools": map[string]any{},
+		},
+		"serverInfo": map[string]any{
+			"name":    s.Name,
+			"version": s.Version,
+		},
+		"instructions": "All tools operate inside the copy-on-write workspace mounted at " + s.Root,
+	}, nil
+}
+
+func (s *Server) listTools() any {
+	var list []map[string]any
+
+	for _, item := range s.Tools {
+		list = append(list, map[string]any{
+			"name":        item.Name,
+			"description": item.Description,
+			"inputSchema": item.Schema,
+		})
+	}
+
+	return map[string]any{
+		"tools": list,
+	}
+}
+
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (any, *rpcError) {
+	var p struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{codeInvalidParams, err.Error()}
+	}
+
+	tool, ok := tools.Find(s.Tools, p.Name)
+	if !ok {
+		return nil, &rpcError{codeInvalidParams, "unknown tool: " + p.Name}
+	}
+
+	output, err := tool.Run(ctx, s.Root, p.Arguments)
+	if err != nil {
+		return map[string]any{
+			"content": []content{{"text", err.Error()}},
+			"isError": true,
+		}, nil
+	}
+
+	return map[string]any{
+		"content": []content{{"text", output}},
+		"isError": false,
+	}, nil
+}
+
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	resp := response{
+		JSONRPC: jsonrpcVersion,
+		ID:      id,
+		Result:  result,
+		Error:   rpcErr,
+	}
+
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, _ = s.w.Write(append(buf, '\n'))
+}
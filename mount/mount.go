@@ -0,0 +1,267 @@
+//go:build linux
+
+package mount
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	mountInfo = "/proc/self/mountinfo"
+)
+
+// Error records a failed operation on a mount point and the cause of it.
+type Error struct {
+	Op     string
+	Target string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Op + " " + e.Target + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrMounted is returned by RemoveAll for a directory that is, or contains, a
+// mount point, so files of a live filesystem are never removed.
+var ErrMounted = errors.New("directory is mounted")
+
+// ErrBusy is returned by UnmountStrict for a mount that is still in use.
+var ErrBusy = errors.New("target is busy")
+
+// Mounts returns the mount table of the current process.
+func Mounts() ([]Info, error) {
+	file, err := os.Open(mountInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read mount table")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	return ParseMountInfo(file)
+}
+
+// Lookup returns the topmost mount at target, or nil if nothing is mounted
+// there.
+func Lookup(target string) (*Info, error) {
+	mounts, err := Mounts()
+	if err != nil {
+		return nil, err
+	}
+
+	target = filepath.Clean(target)
+
+	// Later entries are stacked on top of earlier ones
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].Mountpoint == target {
+			return &mounts[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// IsMounted reports whether target is a mount point.
+func IsMounted(target string) (bool, error) {
+	info, err := Lookup(target)
+	if err != nil {
+		return false, err
+	}
+
+	return info != nil, nil
+}
+
+// Unmount unmounts every filesystem stacked at target. A busy mount is
+// detached lazily, and a FUSE mount owned by an unprivileged user is handed
+// to fusermount. Nothing being mounted at target is not an error.
+func Unmount(ctx context.Context, target string) error {
+	return unmountAll(ctx, target, true)
+}
+
+// UnmountStrict unmounts every filesystem stacked at target like Unmount, but
+// never detaches lazily: a mount still in use fails with ErrBusy and stays in
+// place, so no process keeps writing to a filesystem that looks unmounted.
+func UnmountStrict(ctx context.Context, target string) error {
+	return unmountAll(ctx, target, false)
+}
+
+func unmountAll(ctx context.Context, target string, lazy bool) error {
+	target = filepath.Clean(target)
+
+	mounts, err := Mounts()
+	if err != nil {
+		return &Error{"unmount", target, err}
+	}
+
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].Mountpoint != target {
+			continue
+		}
+		if err := unmount(ctx, &mounts[i], lazy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unmount(ctx context.Context, info *Info, lazy bool) error {
+	err := unix.Unmount(info.Mountpoint, 0)
+
+	switch {
+	case err == nil, errors.Is(err, unix.EINVAL), errors.Is(err, unix.ENOENT):
+		// Gone already or unmounted by someone else in the meantime
+		return nil
+	case errors.Is(err, unix.EBUSY) && !lazy:
+		return &Error{"unmount", info.Mountpoint, ErrBusy}
+	case errors.Is(err, unix.EBUSY):
+		if err := unix.Unmount(info.Mountpoint, unix.MNT_DETACH); err != nil {
+			return &Error{"detach", info.Mountpoint, err}
+		}
+		return nil
+	case errors.Is(err, unix.EPERM) && isFuse(info.FSType):
+		return fusermount(ctx, info.Mountpoint, lazy)
+	default:
+		return &Error{"unmount", info.Mountpoint, err}
+	}
+}
+
+func isFuse(fstype string) bool {
+	return fstype == "fuse" || strings.HasPrefix(fstype, "fuse.")
+}
+
+// fusermount unmounts a FUSE filesystem with the setuid helper, which is the
+// only way for the user who mounted it without privileges.
+func fusermount(ctx context.Context, target string, lazy bool) error {
+	var name string
+
+	for _, item := range []string{"fusermount3", "fusermount"} {
+		if _, err := exec.LookPath(item); err == nil {
+			name = item
+			break
+		}
+	}
+
+	if name == "" {
+		return &Error{"unmount", target, errors.New("permission denied and fusermount not found")}
+	}
+
+	var output []byte
+	var err error
+
+	flags := []string{"-u"}
+	if lazy {
+		// Lazy unmount when busy, like the EBUSY case above
+		flags = append(flags, "-uz")
+	}
+
+	for _, flag := range flags {
+		if output, err = exec.CommandContext(ctx, name, flag, target).CombinedOutput(); err == nil {
+			return nil
+		}
+	}
+
+	msg := strings.TrimSpace(string(output))
+
+	// fusermount only reports EBUSY as text
+	if !lazy && strings.Contains(msg, "busy") {
+		return &Error{"unmount", target, ErrBusy}
+	}
+
+	if msg != "" {
+		err = errors.Errorf("%s: %s", name, msg)
+	}
+
+	return &Error{"unmount", target, err}
+}
+
+// Users returns the ids of the processes whose working directory, root,
+// executable or open files are at or below target, which keep it busy.
+func Users(target string) ([]int, error) {
+	target = filepath.Clean(target)
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read processes")
+	}
+
+	below := func(name string) bool {
+		return name == target || strings.HasPrefix(name, target+"/")
+	}
+
+	var pids []int
+
+	for _, item := range entries {
+		pid, err := strconv.Atoi(item.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		dir := filepath.Join("/proc", item.Name())
+
+		links := []string{"cwd", "root", "exe"}
+		if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+			for _, fd := range fds {
+				links = append(links, filepath.Join("fd", fd.Name()))
+			}
+		}
+
+		for _, link := range links {
+			// Processes of other users cannot be read and are skipped
+			if name, err := os.Readlink(filepath.Join(dir, link)); err == nil && below(name) {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+
+	return pids, nil
+}
+
+// RemoveAll removes dir and everything in it, making directories writable
+// first so read-only trees can be removed. It refuses to remove a directory
+// that is or contains a mount point.
+func RemoveAll(dir string) error {
+	dir = filepath.Clean(dir)
+
+	mounts, err := Mounts()
+	if err != nil {
+		return &Error{"remove", dir, err}
+	}
+
+	for _, item := range mounts {
+		if item.Mountpoint == dir || strings.HasPrefix(item.Mountpoint, dir+"/") {
+			return &Error{"remove", dir, ErrMounted}
+		}
+	}
+
+	_ = filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().Perm()&0700 != 0700 {
+			_ = os.Chmod(name, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+
+	if err := os.RemoveAll(dir); err != nil {
+		return &Error{"remove", dir, err}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package mount
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUsers(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sleep", "60")
+	cmd.Dir = filepath.Join(dir, "sub")
+
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	pids, err := Users(dir)
+	if err != nil {
+		t.Fatalf("Users failed: %v", err)
+	}
+	if !slices.Contains(pids, cmd.Process.Pid) {
+		t.Errorf("Users(%q) = %v, want it to contain %d", dir, pids, cmd.Process.Pid)
+	}
+
+	pids, err = Users(dir + "-other")
+	if err != nil {
+		t.Fatalf("Users failed: %v", err)
+	}
+	if slices.Contains(pids, cmd.Process.Pid) {
+		t.Errorf("Users(%q) = %v, want it not to contain %d", dir+"-other", pids, cmd.Process.Pid)
+	}
+}
@@ -0,0 +1,167 @@
+//go:build linux
+
+package mount
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Info describes one entry of the mount table, see proc_pid_mountinfo(5).
+type Info struct {
+	ID           int
+	ParentID     int
+	Major        int
+	Minor        int
+	Root         string
+	Mountpoint   string
+	Options      string
+	Optional     []string
+	FSType       string
+	Source       string
+	SuperOptions map[string]string
+}
+
+// SuperOption returns the value of a filesystem specific option such as the
+// lowerdir of an overlay, and whether it is set.
+func (i *Info) SuperOption(key string) (string, bool) {
+	value, ok := i.SuperOptions[key]
+	return value, ok
+}
+
+// ParseMountInfo reads a mount table in the format of /proc/self/mountinfo.
+func ParseMountInfo(r io.Reader) ([]Info, error) {
+	var mounts []Info
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		info, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid mountinfo line %d", line)
+		}
+		mounts = append(mounts, info)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read mount table")
+	}
+
+	return mounts, nil
+}
+
+// parseLine parses a line like
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// where the optional fields before the separator vary in number.
+func parseLine(line string) (Info, error) {
+	var info Info
+
+	fields := strings.Split(line, " ")
+	if len(fields) < 10 {
+		return info, errors.Errorf("expected at least 10 fields, got %d", len(fields))
+	}
+
+	sep := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			sep = i
+			break
+		}
+	}
+
+	if sep == -1 || len(fields) < sep+4 {
+		return info, errors.New("missing separator or filesystem fields")
+	}
+
+	var err error
+
+	if info.ID, err = strconv.Atoi(fields[0]); err != nil {
+		return info, errors.Wrap(err, "invalid mount id")
+	}
+
+	if info.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+		return info, errors.Wrap(err, "invalid parent id")
+	}
+
+	major, minor, ok := strings.Cut(fields[2], ":")
+	if !ok {
+		return info, errors.Errorf("invalid device %s", fields[2])
+	}
+
+	if info.Major, err = strconv.Atoi(major); err != nil {
+		return info, errors.Wrap(err, "invalid device major")
+	}
+
+	if info.Minor, err = strconv.Atoi(minor); err != nil {
+		return info, errors.Wrap(err, "invalid device minor")
+	}
+
+	info.Root = unescape(fields[3])
+	info.Mountpoint = unescape(fields[4])
+	info.Options = fields[5]
+
+	if sep > 6 {
+		info.Optional = fields[6:sep]
+	}
+
+	info.FSType = fields[sep+1]
+	info.Source = unescape(fields[sep+2])
+	info.SuperOptions = parseOptions(strings.Join(fields[sep+3:], " "))
+
+	return info, nil
+}
+
+// parseOptions splits comma separated options into keys and values, keeping
+// commas escaped with a backslash, as overlay allows in layer paths.
+func parseOptions(s string) map[string]string {
+	options := map[string]string{}
+
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && (s[i] != ',' || (i > 0 && s[i-1] == '\\')) {
+			continue
+		}
+		if item := s[start:i]; item != "" {
+			key, value, _ := strings.Cut(item, "=")
+			options[unescape(key)] = unescape(strings.ReplaceAll(value, `\,`, ","))
+		}
+		start = i + 1
+	}
+
+	return options
+}
+
+// unescape decodes the octal escapes the kernel uses for space, tab, newline,
+// backslash and, in options, comma and equals sign.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package mount
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    Info
+	}{
+		{
+			fixture: "overlay.mountinfo",
+			want: Info{
+				ID:         412,
+				ParentID:   22,
+				Major:      0,
+				Minor:      58,
+				Root:       "/",
+				Mountpoint: "/home/user/overlay/repo-1a2b3c4",
+				Options:    "rw,relatime",
+				Optional:   []string{"shared:210"},
+				FSType:     "overlay",
+				Source:     "overlay",
+				SuperOptions: map[string]string{
+					"rw":       "",
+					"lowerdir": "/home/user/overlay/lower-repo-1a2b3c4:/home/user/src/repo",
+					"upperdir": "/home/user/overlay/upper-repo-1a2b3c4",
+					"workdir":  "/home/user/overlay/work-repo-1a2b3c4",
+					"uuid":     "on",
+				},
+			},
+		},
+		{
+			fixture: "fuse.mountinfo",
+			want: Info{
+				ID:         531,
+				ParentID:   22,
+				Major:      0,
+				Minor:      62,
+				Root:       "/",
+				Mountpoint: "/home/user/overlay/repo",
+				Options:    "rw,nosuid,nodev,relatime",
+				Optional:   []string{"shared:301"},
+				FSType:     "fuse.fuse-overlayfs",
+				Source:     "fuse-overlayfs",
+				SuperOptions: map[string]string{
+					"rw":                  "",
+					"user_id":             "1000",
+					"group_id":            "1000",
+					"default_permissions": "",
+					"allow_other":         "",
+				},
+			},
+		},
+		{
+			fixture: "escaped.mountinfo",
+			want: Info{
+				ID:         600,
+				ParentID:   22,
+				Major:      0,
+				Minor:      70,
+				Root:       "/sub dir",
+				Mountpoint: "/mnt/my work\tspace",
+				Options:    "rw,relatime",
+				Optional:   []string{"shared:5", "master:2", "propagate_from:1"},
+				FSType:     "overlay",
+				Source:     `my\overlay`,
+				SuperOptions: map[string]string{
+					"rw":       "",
+					"lowerdir": "/src/a,b:/src/c",
+					"upperdir": "/up per",
+					"workdir":  "/work",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = file.Close()
+			}()
+
+			mounts, err := ParseMountInfo(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := mounts[len(mounts)-1]
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMountInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMountInfoInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "22 1 8:1 / / rw - ext4"},
+		{"no separator", "22 1 8:1 / / rw shared:1 ext4 /dev/sda1 rw x"},
+		{"bad id", "x 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw"},
+		{"bad device", "22 1 8-1 / / rw,relatime - ext4 /dev/sda1 rw"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMountInfo(strings.NewReader(tt.line + "\n")); err == nil {
+				t.Errorf("ParseMountInfo(%q) succeeded, want error", tt.line)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package overlay
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Conflicts returns the changed paths whose file in target is no longer as
+// recorded in base, which means applying would overwrite work done outside
+// the workspace. Without a manifest it falls back to files modified, created
+// or replaced after since.
+func Conflicts(target string, changes []Change, base Manifest, since time.Time) []string {
+	var conflicts []string
+
+	for _, item := range changes {
+		if base != nil {
+			if base.Changed(target, item.Path) {
+				conflicts = append(conflicts, item.Path)
+			}
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(target, item.Path))
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(since) {
+			conflicts = append(conflicts, item.Path)
+		}
+	}
+
+	return conflicts
+}
+
+// Apply replays changes from the upper layer onto target. Deletions run
+// first so files replacing directories, and directories replacing files,
+// land on a clean path.
+func Apply(upper, target string, changes []Change) error {
+	for _, item := range changes {
+		if item.Kind != Deleted {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(target, item.Path)); err != nil {
+			return errors.Wrapf(err, "failed to delete %s", item.Path)
+		}
+		pruneDirs(upper, target, item.Path)
+	}
+
+	for _, item := range changes {
+		if item.Kind == Deleted {
+			continue
+		}
+		if err := copyEntry(filepath.Join(upper, item.Path), filepath.Join(target, item.Path)); err != nil {
+			return errors.Wrapf(err, "failed to write %s", item.Path)
+		}
+	}
+
+	return nil
+}
+
+// pruneDirs removes the parents of a deleted file that the upper layer has
+// whited out as a whole, since deletions are reported per file.
+func pruneDirs(upper, target, rel string) {
+	for dir := filepath.Dir(rel); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+		if !whitedOut(upper, dir) {
+			continue
+		}
+		_ = os.RemoveAll(filepath.Join(target, dir))
+	}
+}
+
+func whitedOut(upper, rel string) bool {
+	if info, err := os.Lstat(filepath.Join(upper, rel)); err == nil {
+		return IsWhiteout(rel, info)
+	}
+
+	dir, base := filepath.Split(rel)
+	_, err := os.Lstat(filepath.Join(upper, dir, whiteoutPrefix+base))
+
+	return err == nil
+}
+
+func copyEntry(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	// A directory or file of another type in the way is replaced, as in the
+	// merged view
+	if old, err := os.Lstat(dst); err == nil && (old.IsDir() || old.Mode().Type() != info.Mode().Type()) {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(dst)
+		return os.Symlink(link, dst)
+	}
+
+	if !info.Mode().IsRegular() {
+		return errors.Errorf("unsupported file type %s", strings.TrimSpace(info.Mode().Type().String()))
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(in)
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Chmod(dst, info.Mode().Perm())
+}
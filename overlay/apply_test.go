@@ -0,0 +1,173 @@
+//go:build linux
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	upper := t.TempDir()
+	target := t.TempDir()
+
+	writeTestFile(t, target, "edit", "old\n")
+	writeTestFile(t, target, "gone", "gone\n")
+	writeTestFile(t, target, "keep", "keep\n")
+	writeTestFile(t, target, "tree/a", "a\n")
+	writeTestFile(t, target, "tree/sub/b", "b\n")
+	writeTestFile(t, target, "swap/c", "c\n")
+
+	writeTestFile(t, upper, "edit", "new\n")
+	writeTestFile(t, upper, ".wh.gone", "")
+	writeTestFile(t, upper, ".wh.tree", "")
+	writeTestFile(t, upper, "swap", "file now\n")
+	writeTestFile(t, upper, "new/dir/file", "fresh\n")
+
+	if err := os.Symlink("keep", filepath.Join(upper, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(upper, "edit"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []Change{
+		{"edit", Modified},
+		{"gone", Deleted},
+		{"link", Added},
+		{"new/dir/file", Added},
+		{"swap", Added},
+		{"swap/c", Deleted},
+		{"tree/a", Deleted},
+		{"tree/sub/b", Deleted},
+	}
+
+	if err := Apply(upper, target, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+
+	err := filepath.Walk(target, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == target {
+			return err
+		}
+		rel, _ := filepath.Rel(target, p)
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, _ := os.Readlink(p)
+			files[rel] = "-> " + link
+		case info.IsDir():
+			files[rel] = "/"
+		default:
+			buf, _ := os.ReadFile(p)
+			files[rel] = string(buf)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"edit":         "new\n",
+		"keep":         "keep\n",
+		"link":         "-> keep",
+		"new":          "/",
+		"new/dir":      "/",
+		"new/dir/file": "fresh\n",
+		"swap":         "file now\n",
+	}
+
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Apply() gave %v, want %v", files, want)
+	}
+
+	if info, err := os.Stat(filepath.Join(target, "edit")); err != nil || info.Mode().Perm() != 0o755 {
+		t.Errorf("expected mode of edit to be applied, got %v, %v", info, err)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	target := t.TempDir()
+
+	writeTestFile(t, target, "same", "same\n")
+	writeTestFile(t, target, "edited", "old\n")
+	writeTestFile(t, target, "resized", "old\n")
+	writeTestFile(t, target, "chmod", "old\n")
+	writeTestFile(t, target, "removed", "old\n")
+	writeTestFile(t, target, "dir/file", "old\n")
+	writeTestFile(t, target, ".git/HEAD", "ref: refs/heads/main\n")
+
+	base, err := NewManifest(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := base[".git/HEAD"]; ok {
+		t.Error("expected .git to be left out of manifest")
+	}
+
+	// Same size and an older time than since, which mtime alone misses
+	past := time.Now().Add(-time.Hour)
+
+	writeTestFile(t, target, "edited", "new\n")
+	if err := os.Chtimes(filepath.Join(target, "edited"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, target, "resized", "longer\n")
+	writeTestFile(t, target, "created", "new\n")
+
+	if err := os.Chmod(filepath.Join(target, "chmod"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(target, "removed")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []Change{
+		{"chmod", Modified},
+		{"created", Modified},
+		{"dir", Modified},
+		{"edited", Modified},
+		{"missing", Added},
+		{"removed", Modified},
+		{"resized", Modified},
+		{"same", Modified},
+	}
+
+	want := []string{"chmod", "created", "edited", "removed", "resized"}
+
+	if got := Conflicts(target, changes, base, time.Now()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conflicts() = %v, want %v", got, want)
+	}
+
+	// A manifest survives being stored
+	name := filepath.Join(t.TempDir(), "state", "manifest.json")
+
+	if err := WriteManifest(name, base); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := ReadManifest(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Conflicts(target, changes, stored, time.Now()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conflicts() with stored manifest = %v, want %v", got, want)
+	}
+
+	if missing, err := ReadManifest(filepath.Join(t.TempDir(), "missing")); err != nil || missing != nil {
+		t.Errorf("ReadManifest of missing file = %v, %v", missing, err)
+	}
+
+	// Without a manifest only files newer than since are reported
+	if got := Conflicts(target, changes, nil, past.Add(time.Minute)); !reflect.DeepEqual(got, []string{"chmod", "created", "dir", "resized", "same"}) {
+		t.Errorf("Conflicts() without manifest = %v", got)
+	}
+}
@@ -0,0 +1,334 @@
+//go:build linux
+
+package overlay
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	xattrPrefix = "SCHILY.xattr."
+)
+
+// Archive writes dir as a gzipped tar stream, keeping whiteout devices,
+// symlinks and extended attributes such as the opaque markers so an upper
+// layer can be restored as it was.
+func Archive(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, p)
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Format = tar.FormatPAX
+
+		// Symlinks cannot carry xattrs that matter to overlayfs
+		if info.Mode()&os.ModeSymlink == 0 {
+			hdr.PAXRecords, err = readXattrs(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+
+		_, err = io.Copy(tw, file)
+
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to archive directory")
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// Extract replaces the contents of dir with an archive written by Archive.
+// Whiteout devices that cannot be created without privileges fall back to
+// .wh. files, and trusted opaque xattrs to the .wh..wh..opq marker, which is
+// what fuse-overlayfs uses in that case. The archive is unpacked next to dir
+// and only renamed over it once complete, so a corrupt archive leaves dir as
+// it was.
+func Extract(r io.Reader, dir string) error {
+	dir = filepath.Clean(dir)
+
+	perm := os.FileMode(0755)
+	info, err := os.Stat(dir)
+	if err == nil {
+		perm = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to read directory")
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-extract-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create directory")
+	}
+
+	if err := extractTo(r, tmp); err != nil {
+		_ = removeDir(tmp)
+		return err
+	}
+
+	if info != nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+			_ = os.Lchown(tmp, int(stat.Uid), int(stat.Gid))
+		}
+	}
+
+	if err := os.Chmod(tmp, perm); err != nil {
+		_ = removeDir(tmp)
+		return err
+	}
+
+	if info == nil {
+		return os.Rename(tmp, dir)
+	}
+
+	old := tmp + "-old"
+
+	if err := os.Rename(dir, old); err != nil {
+		_ = removeDir(tmp)
+		return errors.Wrap(err, "failed to replace directory")
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.Rename(old, dir)
+		_ = removeDir(tmp)
+		return errors.Wrap(err, "failed to replace directory")
+	}
+
+	if err := removeDir(old); err != nil {
+		return errors.Wrap(err, "failed to remove replaced directory")
+	}
+
+	return nil
+}
+
+func extractTo(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read archive")
+	}
+
+	defer func(gz *gzip.Reader) {
+		_ = gz.Close()
+	}(gz)
+
+	type dirMeta struct {
+		path  string
+		mode  os.FileMode
+		mtime time.Time
+	}
+
+	var dirs []dirMeta
+
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read archive")
+		}
+
+		rel := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || filepath.IsAbs(rel) {
+			return errors.Errorf("invalid path %s in archive", hdr.Name)
+		}
+
+		target := filepath.Join(dir, rel)
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMeta{target, mode, hdr.ModTime})
+		case tar.TypeReg:
+			if err := writeFile(target, tr, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeChar:
+			dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+			if err := unix.Mknod(target, unix.S_IFCHR|uint32(mode), int(dev)); err != nil {
+				if hdr.Devmajor != 0 || hdr.Devminor != 0 {
+					return errors.Wrapf(err, "failed to create device %s", hdr.Name)
+				}
+				dirName, base := filepath.Split(target)
+				if err := os.WriteFile(filepath.Join(dirName, whiteoutPrefix+base), nil, 0644); err != nil {
+					return err
+				}
+				continue
+			}
+		default:
+			continue
+		}
+
+		if err := writeXattrs(target, hdr.PAXRecords); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag != tar.TypeDir {
+			_ = os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+	}
+
+	// Directories stay writable and their times change while their contents
+	// are written, so both are restored last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Chmod(dirs[i].path, dirs[i].mode)
+		_ = os.Chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime)
+	}
+
+	return nil
+}
+
+func readXattrs(name string) (map[string]string, error) {
+	size, err := syscall.Listxattr(name, nil)
+	if err != nil || size == 0 {
+		// Filesystems without xattr support simply have none
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+
+	size, err = syscall.Listxattr(name, buf)
+	if err != nil {
+		return nil, nil
+	}
+
+	records := map[string]string{}
+
+	for _, key := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if key == "" {
+			continue
+		}
+		n, err := syscall.Getxattr(name, key, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(name, key, value); err != nil {
+			continue
+		}
+		records[xattrPrefix+key] = string(value[:n])
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return records, nil
+}
+
+func writeXattrs(name string, records map[string]string) error {
+	for key, value := range records {
+		attr, ok := strings.CutPrefix(key, xattrPrefix)
+		if !ok {
+			continue
+		}
+		// trusted.* needs privileges, everything else is best effort
+		if err := syscall.Setxattr(name, attr, []byte(value), 0); err == nil {
+			continue
+		}
+		if strings.HasSuffix(attr, ".opaque") && value == "y" {
+			if err := os.WriteFile(filepath.Join(name, opaqueMarker), nil, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeFile(name string, r io.Reader, mode os.FileMode) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Chmod(name, mode)
+}
+
+// removeDir removes dir, making read-only subdirectories writable first so
+// their contents can be removed.
+func removeDir(dir string) error {
+	_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Mode().Perm()&0700 != 0700 {
+			_ = os.Chmod(p, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+
+	return os.RemoveAll(dir)
+}
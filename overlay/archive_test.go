@@ -0,0 +1,117 @@
+//go:build linux
+
+package overlay
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestArchiveExtract(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(src, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, ".wh.gone"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir/file", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	xattr := syscall.Setxattr(filepath.Join(src, "dir"), "user.overlay.opaque", []byte("y"), 0) == nil
+
+	// Existing contents of the destination are replaced
+	if err := os.WriteFile(filepath.Join(dst, "stale"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := Archive(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Extract(&buf, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dst, "stale")); !os.IsNotExist(err) {
+		t.Errorf("expected stale file to be removed, got %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "dir", "file"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected file %v, %v", info, err)
+	}
+
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "dir/file" {
+		t.Errorf("unexpected link %q, %v", link, err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dst, ".wh.gone")); err != nil {
+		t.Errorf("expected whiteout to be kept, got %v", err)
+	}
+
+	if xattr && !IsOpaque(filepath.Join(dst, "dir")) {
+		t.Errorf("expected opaque directory to be kept")
+	}
+}
+
+func TestExtractCorrupt(t *testing.T) {
+	src := t.TempDir()
+	base := t.TempDir()
+	dst := filepath.Join(base, "upper")
+
+	for _, dir := range []string{src, dst} {
+		if err := os.MkdirAll(filepath.Join(dir, "dir"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "dir", "file"), bytes.Repeat([]byte("snapshot\n"), 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "dir", "work"), []byte("keep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := Archive(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	for _, input := range [][]byte{data[:len(data)/2], []byte("not an archive")} {
+		if err := Extract(bytes.NewReader(input), dst); err == nil {
+			t.Fatal("Extract of corrupt archive succeeded, want error")
+		}
+
+		if buf, err := os.ReadFile(filepath.Join(dst, "dir", "work")); err != nil || string(buf) != "keep\n" {
+			t.Errorf("expected upper layer to be kept, got %q, %v", buf, err)
+		}
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected only the upper layer to be left, got %v, %v", entries, err)
+	}
+
+	if err := Extract(bytes.NewReader(data), dst); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dst, "dir", "work")); !os.IsNotExist(err) {
+		t.Errorf("expected work file to be replaced, got %v", err)
+	}
+}
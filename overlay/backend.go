@@ -0,0 +1,160 @@
+//go:build linux
+
+package overlay
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	BackendAuto   = "auto"
+	BackendKernel = "kernel"
+	BackendFuse   = "fuse"
+)
+
+// Options describes one overlay mount, with lower layers ordered top to
+// bottom.
+type Options struct {
+	Lowers []string
+	Upper  string
+	Work   string
+	Target string
+}
+
+func (o Options) String() string {
+	return fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", strings.Join(o.Lowers, ":"), o.Upper, o.Work)
+}
+
+// Validate rejects layer paths the mount options cannot hold, since commas
+// separate the options, colons the lower layers and backslashes escape both,
+// which fuse-overlayfs does not understand the way the kernel does.
+func (o Options) Validate() error {
+	for _, item := range append(append([]string(nil), o.Lowers...), o.Upper, o.Work) {
+		if strings.ContainsAny(item, `,:\`) {
+			return errors.Errorf("layer path %s contains one of ',', ':' or '\\', which overlay cannot mount", item)
+		}
+	}
+
+	return nil
+}
+
+// Backend mounts an overlay. Available reports why a backend cannot be used
+// on this host, so auto selection can skip it.
+type Backend interface {
+	Name() string
+	Available() error
+	Mount(opts Options) error
+}
+
+// NewBackend returns the backend called name. Auto prefers the kernel and
+// falls back to fuse-overlayfs when the kernel one is not available.
+func NewBackend(name string) (Backend, error) {
+	switch name {
+	case BackendKernel:
+		return Kernel{}, nil
+	case BackendFuse, "":
+		return Fuse{}, nil
+	case BackendAuto:
+		if err := (Kernel{}).Available(); err == nil {
+			return Kernel{}, nil
+		}
+		return Fuse{}, nil
+	default:
+		return nil, errors.Errorf("unknown overlay backend %s", name)
+	}
+}
+
+// Kernel mounts overlayfs with mount(2). Unprivileged overlay mounts are
+// only possible inside a user namespace and vanish with it, which does not
+// suit a workspace shared by later commands, so this needs root and is not
+// offered to other users at all.
+type Kernel struct{}
+
+func (Kernel) Name() string {
+	return BackendKernel
+}
+
+func (Kernel) Available() error {
+	if os.Geteuid() != 0 {
+		return errors.New("requires root, use the fuse backend without it")
+	}
+
+	file, err := os.Open("/proc/filesystems")
+	if err != nil {
+		return errors.Wrap(err, "failed to read supported filesystems")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[len(fields)-1] == "overlay" {
+			return nil
+		}
+	}
+
+	return errors.New("overlay filesystem not supported by kernel")
+}
+
+func (k Kernel) Mount(opts Options) error {
+	if err := k.Available(); err != nil {
+		return errors.Wrap(err, "kernel overlayfs not available")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	if err := syscall.Mount("overlay", opts.Target, "overlay", 0, opts.String()); err != nil {
+		return errors.Wrap(err, "failed to mount overlay with kernel overlayfs")
+	}
+
+	return nil
+}
+
+// Fuse mounts with the fuse-overlayfs binary, which works without
+// privileges.
+type Fuse struct{}
+
+func (Fuse) Name() string {
+	return BackendFuse
+}
+
+func (Fuse) Available() error {
+	if _, err := exec.LookPath("fuse-overlayfs"); err != nil {
+		return errors.New("fuse-overlayfs not found")
+	}
+
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		return errors.New("/dev/fuse not found")
+	}
+
+	return nil
+}
+
+func (Fuse) Mount(opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("fuse-overlayfs", "-o", opts.String(), opts.Target)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return errors.Wrapf(err, "failed to mount overlay with fuse-overlayfs: %s", msg)
+		}
+		return errors.Wrap(err, "failed to mount overlay with fuse-overlayfs")
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package overlay
+
+import (
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	opts := Options{
+		Lowers: []string{"/ws/lower-a", "/repo"},
+		Upper:  "/ws/upper-a",
+		Work:   "/ws/work-a",
+		Target: "/ws/a",
+	}
+
+	if got, want := opts.String(), "lowerdir=/ws/lower-a:/repo,upperdir=/ws/upper-a,workdir=/ws/work-a"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+
+	tests := []Options{
+		{Lowers: []string{"/repo,v2"}, Upper: opts.Upper, Work: opts.Work},
+		{Lowers: []string{"/repo:v2"}, Upper: opts.Upper, Work: opts.Work},
+		{Lowers: []string{`/repo\v2`}, Upper: opts.Upper, Work: opts.Work},
+		{Lowers: opts.Lowers, Upper: "/ws/upper-a,b", Work: opts.Work},
+		{Lowers: opts.Lowers, Upper: opts.Upper, Work: "/ws/work-a:b"},
+	}
+
+	for _, test := range tests {
+		if err := test.Validate(); err == nil {
+			t.Errorf("Validate() of %s succeeded, want error", test)
+		}
+	}
+
+	for _, backend := range []Backend{Kernel{}, Fuse{}} {
+		if err := backend.Mount(tests[0]); err == nil {
+			t.Errorf("%s Mount() of %s succeeded, want error", backend.Name(), tests[0])
+		}
+	}
+}
@@ -0,0 +1,298 @@
+//go:build linux
+
+package overlay
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueMarker   = ".wh..wh..opq"
+)
+
+// opaqueXattrs mark a directory whose lower contents are hidden, as written
+// by the kernel with and without privileges and by fuse-overlayfs.
+var opaqueXattrs = []string{
+	"trusted.overlay.opaque",
+	"user.overlay.opaque",
+	"user.fuseoverlayfs.opaque",
+}
+
+type Kind string
+
+const (
+	Added    Kind = "A"
+	Modified Kind = "M"
+	Deleted  Kind = "D"
+)
+
+// Change is a file in the merged view that differs from the lower layers.
+type Change struct {
+	Path string
+	Kind Kind
+}
+
+// Changes walks the upper layer and reports every file added, modified or
+// deleted relative to the lower layers, which are ordered top to bottom.
+func Changes(upper string, lowers ...string) ([]Change, error) {
+	var changes []Change
+	var opaque []string
+
+	if _, err := os.Stat(upper); err != nil {
+		return nil, errors.Wrap(err, "failed to read upper directory")
+	}
+
+	err := filepath.Walk(upper, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == upper {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(upper, p)
+		name := filepath.Base(rel)
+
+		if name == opaqueMarker {
+			return nil
+		}
+
+		if target, ok := whiteoutTarget(rel, info); ok {
+			changes = append(changes, deleted(target, lowers)...)
+			return nil
+		}
+
+		lowerInfo, lowerPath := Lookup(lowers, rel)
+
+		if info.IsDir() {
+			if lowerInfo != nil && !lowerInfo.IsDir() {
+				changes = append(changes, Change{rel, Deleted})
+			} else if lowerInfo != nil && IsOpaque(p) {
+				opaque = append(opaque, rel)
+			}
+			return nil
+		}
+
+		switch {
+		case lowerInfo == nil:
+			changes = append(changes, Change{rel, Added})
+		case lowerInfo.IsDir():
+			changes = append(changes, deleted(rel, lowers)...)
+			changes = append(changes, Change{rel, Added})
+		case differ(p, info, lowerPath, lowerInfo):
+			changes = append(changes, Change{rel, Modified})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk upper directory")
+	}
+
+	// An opaque directory hides every lower file it does not provide again
+	for _, dir := range opaque {
+		for _, item := range deleted(dir, lowers) {
+			info, err := os.Lstat(filepath.Join(upper, item.Path))
+			if err == nil && !info.IsDir() && !IsWhiteout(item.Path, info) {
+				continue
+			}
+			changes = append(changes, item)
+		}
+	}
+
+	return dedupe(changes), nil
+}
+
+// IsOpaque reports whether an upper directory hides the lower directories
+// below it, either through an xattr or through the .wh..wh..opq marker used
+// without privileges.
+func IsOpaque(dir string) bool {
+	buf := make([]byte, 8)
+
+	for _, name := range opaqueXattrs {
+		if n, err := syscall.Getxattr(dir, name, buf); err == nil && n > 0 && buf[0] == 'y' {
+			return true
+		}
+	}
+
+	_, err := os.Lstat(filepath.Join(dir, opaqueMarker))
+
+	return err == nil
+}
+
+// Lookup resolves rel through the lower layers the way overlayfs does and
+// returns the first match.
+func Lookup(lowers []string, rel string) (os.FileInfo, string) {
+	for _, item := range lowers {
+		p := filepath.Join(item, rel)
+		if info, err := os.Lstat(p); err == nil {
+			return info, p
+		}
+	}
+
+	return nil, ""
+}
+
+// IsWhiteout reports whether an upper entry hides a lower one, either as a
+// 0/0 character device or as a .wh. prefixed file used without privileges.
+func IsWhiteout(name string, info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice != 0 && info.Mode()&os.ModeDevice != 0 {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Rdev == 0 {
+			return true
+		}
+	}
+
+	base := filepath.Base(name)
+
+	return strings.HasPrefix(base, whiteoutPrefix) && base != opaqueMarker
+}
+
+func whiteoutTarget(rel string, info os.FileInfo) (string, bool) {
+	if !IsWhiteout(rel, info) {
+		return "", false
+	}
+
+	dir, base := filepath.Split(rel)
+	if trimmed, ok := strings.CutPrefix(base, whiteoutPrefix); ok {
+		base = trimmed
+	}
+
+	return filepath.Join(dir, base), true
+}
+
+// deleted expands a removed lower path into the files it hid.
+func deleted(rel string, lowers []string) []Change {
+	var changes []Change
+
+	info, _ := Lookup(lowers, rel)
+	if info == nil {
+		return nil
+	}
+
+	if !info.IsDir() {
+		return []Change{{rel, Deleted}}
+	}
+
+	seen := map[string]bool{}
+
+	for _, lower := range lowers {
+		_ = filepath.Walk(filepath.Join(lower, rel), func(q string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return nil
+			}
+			sub, _ := filepath.Rel(lower, q)
+			if !seen[sub] {
+				seen[sub] = true
+				changes = append(changes, Change{sub, Deleted})
+			}
+			return nil
+		})
+	}
+
+	return changes
+}
+
+// InGitDir reports whether rel is the .git directory of the repo or below it,
+// which holds the commits made inside a workspace rather than its files.
+func InGitDir(rel string) bool {
+	return rel == ".git" || strings.HasPrefix(rel, ".git/")
+}
+
+// WithoutGitDir returns changes without those in the .git directory.
+func WithoutGitDir(changes []Change) []Change {
+	var out []Change
+
+	for _, item := range changes {
+		if !InGitDir(item.Path) {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
+
+// dedupe sorts changes by path and drops repeats, which whiteouts inside an
+// opaque directory produce.
+func dedupe(changes []Change) []Change {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	var out []Change
+
+	for i, item := range changes {
+		if i > 0 && item == changes[i-1] {
+			continue
+		}
+		out = append(out, item)
+	}
+
+	return out
+}
+
+func differ(upperPath string, upperInfo os.FileInfo, lowerPath string, lowerInfo os.FileInfo) bool {
+	if upperInfo.Mode().Type() != lowerInfo.Mode().Type() || upperInfo.Mode().Perm() != lowerInfo.Mode().Perm() {
+		return true
+	}
+
+	if upperInfo.Mode()&os.ModeSymlink != 0 {
+		a, _ := os.Readlink(upperPath)
+		b, _ := os.Readlink(lowerPath)
+		return a != b
+	}
+
+	if upperInfo.Size() != lowerInfo.Size() {
+		return true
+	}
+
+	same, err := sameContent(upperPath, lowerPath)
+
+	return err != nil || !same
+}
+
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(fa)
+
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(fb)
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA != nil || errB != nil {
+			return errA == errB || (isEOF(errA) && isEOF(errB)), nil
+		}
+	}
+}
+
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	lower := t.TempDir()
+	upper := t.TempDir()
+
+	write := func(root, name, content string) {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(lower, "same", "same\n")
+	write(lower, "edit", "old\n")
+	write(lower, "gone", "gone\n")
+	write(lower, "dir/a", "a\n")
+	write(lower, "dir/b", "b\n")
+	write(lower, "opq/hidden", "hidden\n")
+	write(lower, "opq/kept", "kept\n")
+
+	write(upper, "same", "same\n")
+	write(upper, "edit", "new\n")
+	write(upper, ".wh.gone", "")
+	write(upper, "dir/.wh.a", "")
+	write(upper, "dir/c", "c\n")
+	write(upper, "opq/.wh..wh..opq", "")
+	write(upper, "opq/kept", "kept\n")
+	write(upper, "opq/fresh", "fresh\n")
+
+	changes, err := Changes(upper, lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Change{
+		{"dir/a", Deleted},
+		{"dir/c", Added},
+		{"edit", Modified},
+		{"gone", Deleted},
+		{"opq/fresh", Added},
+		{"opq/hidden", Deleted},
+	}
+
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Changes() = %v, want %v", changes, want)
+	}
+}
+
+func TestWithoutGitDir(t *testing.T) {
+	changes := []Change{
+		{".git", Added},
+		{".git/index", Modified},
+		{".git/refs/heads/main", Added},
+		{".gitignore", Modified},
+		{".github/workflows/ci.yml", Added},
+		{"src/.git/HEAD", Added},
+		{"main.go", Deleted},
+	}
+
+	want := []Change{
+		{".gitignore", Modified},
+		{".github/workflows/ci.yml", Added},
+		{"src/.git/HEAD", Added},
+		{"main.go", Deleted},
+	}
+
+	if got := WithoutGitDir(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("WithoutGitDir() = %v, want %v", got, want)
+	}
+}
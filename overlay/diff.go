@@ -0,0 +1,412 @@
+//go:build linux
+
+package overlay
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	diffContext  = 3
+	maxDiffBytes = 1024 * 1024
+	// maxSnakeCost is how many edits middleSnake searches from each end
+	// before it gives up and the region is replaced as a whole
+	maxSnakeCost = 4096
+	nullHash     = "0000000000000000000000000000000000000000"
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	a, b int
+}
+
+// WriteDiff writes a unified diff of every change, reading old content from
+// the lower layers and new content from the upper layer.
+func WriteDiff(w io.Writer, upper string, lowers []string, changes []Change) error {
+	for _, item := range changes {
+		var oldData, newData []byte
+		var mode string
+		var err error
+
+		if item.Kind != Added {
+			if _, p := Lookup(lowers, item.Path); p != "" {
+				if oldData, err = readContent(p); err != nil {
+					return err
+				}
+				mode = fileMode(p)
+			}
+		}
+
+		if item.Kind != Deleted {
+			p := filepath.Join(upper, item.Path)
+			if newData, err = readContent(p); err != nil {
+				return err
+			}
+			mode = fileMode(p)
+		}
+
+		if err := writeFileDiff(w, item, mode, oldData, newData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readContent(name string) ([]byte, error) {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(name)
+		return []byte(target), err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	if info.Size() > maxDiffBytes {
+		// Treated as binary so huge files never end up in a patch
+		return []byte{0}, nil
+	}
+
+	return os.ReadFile(name)
+}
+
+// fileMode returns the git mode of a file for the headers of added and
+// deleted files.
+func fileMode(name string) string {
+	info, err := os.Lstat(name)
+
+	switch {
+	case err != nil:
+		return "100644"
+	case info.Mode()&os.ModeSymlink != 0:
+		return "120000"
+	case info.Mode()&0o111 != 0:
+		return "100755"
+	default:
+		return "100644"
+	}
+}
+
+func writeFileDiff(w io.Writer, item Change, mode string, oldData, newData []byte) error {
+	oldName, newName := "a/"+item.Path, "b/"+item.Path
+
+	switch item.Kind {
+	case Added:
+		oldName = "/dev/null"
+	case Deleted:
+		newName = "/dev/null"
+	}
+
+	// Git style headers let patch and git apply create and remove empty files,
+	// which have no hunk to carry them
+	if _, err := fmt.Fprintf(w, "diff --git a/%s b/%s\n", item.Path, item.Path); err != nil {
+		return err
+	}
+
+	switch item.Kind {
+	case Added:
+		if _, err := fmt.Fprintf(w, "new file mode %s\n", mode); err != nil {
+			return err
+		}
+	case Deleted:
+		if _, err := fmt.Fprintf(w, "deleted file mode %s\n", mode); err != nil {
+			return err
+		}
+	}
+
+	if isBinary(oldData) || isBinary(newData) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+		return err
+	}
+
+	oldHash, newHash := blobHash(oldData), blobHash(newData)
+
+	switch item.Kind {
+	case Added:
+		oldHash = nullHash
+	case Deleted:
+		newHash = nullHash
+	}
+
+	// GNU patch only removes an emptied file when the index line is present
+	if _, err := fmt.Fprintf(w, "index %s..%s\n", oldHash, newHash); err != nil {
+		return err
+	}
+
+	oldLines, newLines := splitLines(oldData), splitLines(newData)
+
+	hunks := buildHunks(myers(oldLines, newLines))
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName); err != nil {
+		return err
+	}
+
+	for _, hunk := range hunks {
+		if err := writeHunk(w, hunk, oldLines, newLines); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blobHash returns the git object id of data stored as a blob.
+func blobHash(data []byte) string {
+	hash := sha1.New()
+	_, _ = fmt.Fprintf(hash, "blob %d\x00", len(data))
+	_, _ = hash.Write(data)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isBinary(data []byte) bool {
+	n := len(data)
+	if n > 8000 {
+		n = 8000
+	}
+
+	return bytes.IndexByte(data[:n], 0) >= 0
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// myers computes the shortest edit script between a and b. It uses the linear
+// space refinement of the algorithm: the middle snake of a shortest path
+// splits the problem in two, which are solved the same way, so memory stays
+// proportional to the input even for a file rewritten as a whole.
+func myers(a, b []string) []op {
+	var ops []op
+
+	var walk func(a0, a1, b0, b1 int)
+
+	walk = func(a0, a1, b0, b1 int) {
+		// Common prefix and suffix never need the search
+		for a0 < a1 && b0 < b1 && a[a0] == b[b0] {
+			ops = append(ops, op{opEqual, a0, b0})
+			a0++
+			b0++
+		}
+
+		suffix := 0
+		for a0 < a1-suffix && b0 < b1-suffix && a[a1-1-suffix] == b[b1-1-suffix] {
+			suffix++
+		}
+
+		switch {
+		case a0 == a1-suffix:
+			for j := b0; j < b1-suffix; j++ {
+				ops = append(ops, op{opInsert, a0, j})
+			}
+		case b0 == b1-suffix:
+			for i := a0; i < a1-suffix; i++ {
+				ops = append(ops, op{opDelete, i, b0})
+			}
+		default:
+			x, y, u, v, ok := middleSnake(a, b, a0, a1-suffix, b0, b1-suffix)
+			if !ok {
+				for i := a0; i < a1-suffix; i++ {
+					ops = append(ops, op{opDelete, i, b0})
+				}
+				for j := b0; j < b1-suffix; j++ {
+					ops = append(ops, op{opInsert, a1 - suffix, j})
+				}
+				break
+			}
+			walk(a0, x, b0, y)
+			for ; x < u; x, y = x+1, y+1 {
+				ops = append(ops, op{opEqual, x, y})
+			}
+			walk(u, a1-suffix, v, b1-suffix)
+		}
+
+		for i := suffix; i > 0; i-- {
+			ops = append(ops, op{opEqual, a1 - i, b1 - i})
+		}
+	}
+
+	walk(0, len(a), 0, len(b))
+
+	return ops
+}
+
+// middleSnake finds the snake in the middle of a shortest edit path between
+// a[a0:a1] and b[b0:b1] by searching from both ends at once, and returns where
+// it starts and ends. It gives up once the path takes more than twice
+// maxSnakeCost edits, as the search time grows with their number.
+func middleSnake(a, b []string, a0, a1, b0, b1 int) (x, y, u, v int, ok bool) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := min((n+m+1)/2, maxSnakeCost)
+	off := maxD + 1
+
+	// forward[k] holds the furthest x on diagonal k from the start, backward
+	// the same counted from the end
+	forward := make([]int, 2*off+1)
+	backward := make([]int, 2*off+1)
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var fx int
+			if k == -d || (k != d && forward[off+k-1] < forward[off+k+1]) {
+				fx = forward[off+k+1]
+			} else {
+				fx = forward[off+k-1] + 1
+			}
+			sx := fx
+			for fx < n && fx-k < m && a[a0+fx] == b[b0+fx-k] {
+				fx++
+			}
+			forward[off+k] = fx
+			if r := delta - k; odd && r >= -(d-1) && r <= d-1 && fx+backward[off+r] >= n {
+				return a0 + sx, b0 + sx - k, a0 + fx, b0 + fx - k, true
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var bx int
+			if k == -d || (k != d && backward[off+k-1] < backward[off+k+1]) {
+				bx = backward[off+k+1]
+			} else {
+				bx = backward[off+k-1] + 1
+			}
+			sx := bx
+			for bx < n && bx-k < m && a[a1-1-bx] == b[b1-1-(bx-k)] {
+				bx++
+			}
+			backward[off+k] = bx
+			if f := delta - k; !odd && f >= -d && f <= d && bx+forward[off+f] >= n {
+				return a1 - bx, b1 - (bx - k), a1 - sx, b1 - (sx - k), true
+			}
+		}
+	}
+
+	return 0, 0, 0, 0, false
+}
+
+type hunk struct {
+	ops []op
+}
+
+func buildHunks(ops []op) []hunk {
+	var hunks []hunk
+
+	start := -1
+	lastChange := -1
+
+	for i, item := range ops {
+		if item.kind == opEqual {
+			if start >= 0 && i-lastChange > 2*diffContext {
+				hunks = append(hunks, hunk{ops[start : lastChange+diffContext+1]})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i - diffContext
+			if start < 0 {
+				start = 0
+			}
+		}
+		lastChange = i
+	}
+
+	if start >= 0 {
+		end := lastChange + diffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		hunks = append(hunks, hunk{ops[start:end]})
+	}
+
+	return hunks
+}
+
+func writeHunk(w io.Writer, h hunk, a, b []string) error {
+	oldStart, newStart := -1, -1
+	oldCount, newCount := 0, 0
+
+	for _, item := range h.ops {
+		switch item.kind {
+		case opEqual:
+			oldCount++
+			newCount++
+		case opDelete:
+			oldCount++
+		case opInsert:
+			newCount++
+		}
+		if oldStart < 0 {
+			oldStart, newStart = item.a, item.b
+		}
+	}
+
+	if oldCount > 0 {
+		oldStart++
+	}
+
+	if newCount > 0 {
+		newStart++
+	}
+
+	if _, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount); err != nil {
+		return err
+	}
+
+	for _, item := range h.ops {
+		var prefix, line string
+		switch item.kind {
+		case opEqual:
+			prefix, line = " ", a[item.a]
+		case opDelete:
+			prefix, line = "-", a[item.a]
+		case opInsert:
+			prefix, line = "+", b[item.b]
+		}
+		if _, err := fmt.Fprint(w, prefix, line); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(line, "\n") {
+			if _, err := fmt.Fprint(w, "\n\\ No newline at end of file\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
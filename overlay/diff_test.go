@@ -0,0 +1,229 @@
+//go:build linux
+
+package overlay
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// missing stands for a file that does not exist on one side of a diff case.
+const missing = "\x00missing"
+
+func numbered(n int) string {
+	var out strings.Builder
+
+	for i := 1; i <= n; i++ {
+		out.WriteString(strconv.Itoa(i) + "\n")
+	}
+
+	return out.String()
+}
+
+// diffCases map a path to its content in the lower and the upper layer.
+var diffCases = map[string][2]string{
+	"edit":          {"a\nb\nc\nd\ne\nf\ng\n", "a\nb\nc\nD\ne\nf\ng\n"},
+	"hunks":         {numbered(40), strings.Replace(strings.Replace(numbered(40), "\n3\n", "\nthree\n", 1), "\n35\n", "\n", 1)},
+	"insert-head":   {"b\nc\n", "a\nb\nc\n"},
+	"insert-tail":   {"a\nb\n", "a\nb\nc\n"},
+	"insert-middle": {numbered(20), strings.Replace(numbered(20), "\n10\n", "\n10\nnew\nnew\n", 1)},
+	"delete-head":   {"a\nb\nc\n", "b\nc\n"},
+	"delete-tail":   {"a\nb\nc\n", "a\nb\n"},
+	"delete-middle": {numbered(20), strings.Replace(numbered(20), "\n10\n11\n", "\n", 1)},
+	"fill":          {"", "a\nb\n"},
+	"empty":         {"a\nb\n", ""},
+	"drop-newline":  {"a\nb\n", "a\nb"},
+	"add-newline":   {"a\nb", "a\nb\n"},
+	"no-newline":    {"a\nb", "a\nc"},
+	"added":         {missing, "new\n"},
+	"added-empty":   {missing, ""},
+	"added-nonl":    {missing, "new"},
+	"deleted":       {"old\n", missing},
+	"deleted-empty": {"", missing},
+	"deleted-nonl":  {"old", missing},
+	"dir/nested":    {"x\n", "y\n"},
+	"unchanged":     {"same\n", "same\n"},
+}
+
+// TestWriteDiff applies the diff of every case to a copy of the lower layer
+// with patch and git apply, which has to give the upper layer.
+func TestWriteDiff(t *testing.T) {
+	lower := t.TempDir()
+	upper := t.TempDir()
+
+	for name, item := range diffCases {
+		if item[0] != missing {
+			writeTestFile(t, lower, name, item[0])
+		}
+		if item[1] != missing {
+			writeTestFile(t, upper, name, item[1])
+		} else {
+			writeTestFile(t, upper, filepath.Join(filepath.Dir(name), whiteoutPrefix+filepath.Base(name)), "")
+		}
+	}
+
+	changes, err := Changes(upper, lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patch bytes.Buffer
+
+	if err := WriteDiff(&patch, upper, []string{lower}, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	tools := map[string][]string{
+		"patch": {"patch", "-p1", "--batch", "--quiet"},
+		"git":   {"git", "apply", "--unsafe-paths", "-"},
+	}
+
+	for tool, args := range tools {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			t.Logf("%s not found, skipped", args[0])
+			continue
+		}
+
+		t.Run(tool, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for name, item := range diffCases {
+				if item[0] != missing {
+					writeTestFile(t, dir, name, item[0])
+				}
+			}
+
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Dir = dir
+			cmd.Stdin = bytes.NewReader(patch.Bytes())
+
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%s failed: %v\n%s\npatch:\n%s", tool, err, output, patch.String())
+			}
+
+			for name, item := range diffCases {
+				buf, err := os.ReadFile(filepath.Join(dir, name))
+				switch {
+				case item[1] == missing:
+					if err == nil {
+						t.Errorf("%s: expected %s to be deleted", tool, name)
+					}
+				case err != nil:
+					t.Errorf("%s: %v", tool, err)
+				case string(buf) != item[1]:
+					t.Errorf("%s: %s = %q, want %q", tool, name, buf, item[1])
+				}
+			}
+		})
+	}
+}
+
+func TestMyers(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	pick := func() []string {
+		var out []string
+		for range random.Intn(12) {
+			out = append(out, string(rune('a'+random.Intn(4)))+"\n")
+		}
+		return out
+	}
+
+	for range 500 {
+		a, b := pick(), pick()
+
+		edits := checkScript(t, a, b, myers(a, b))
+
+		if lcs := commonLength(a, b); edits != len(a)+len(b)-2*lcs {
+			t.Fatalf("myers(%q, %q) took %d edits, want %d", a, b, edits, len(a)+len(b)-2*lcs)
+		}
+	}
+
+	// A rewrite too costly to search is replaced as a whole around what the
+	// two sides have in common at their ends
+	var a, b []string
+
+	for i := range 20000 {
+		a = append(a, "old "+strconv.Itoa(i)+"\n")
+		b = append(b, "new "+strconv.Itoa(i)+"\n")
+	}
+
+	a = append(append([]string{"head\n"}, a...), "tail\n")
+	b = append(append([]string{"head\n"}, b...), "tail\n")
+
+	if edits := checkScript(t, a, b, myers(a, b)); edits != 40000 {
+		t.Errorf("myers() of rewrite took %d edits, want 40000", edits)
+	}
+}
+
+// checkScript fails unless ops turn a into b, and returns how many edits
+// they take.
+func checkScript(t *testing.T, a, b []string, ops []op) int {
+	t.Helper()
+
+	var gotA, gotB []string
+	var edits int
+
+	for _, item := range ops {
+		switch item.kind {
+		case opEqual:
+			if a[item.a] != b[item.b] {
+				t.Fatalf("myers() matched %q with %q", a[item.a], b[item.b])
+			}
+			gotA = append(gotA, a[item.a])
+			gotB = append(gotB, b[item.b])
+		case opDelete:
+			gotA = append(gotA, a[item.a])
+			edits++
+		case opInsert:
+			gotB = append(gotB, b[item.b])
+			edits++
+		}
+	}
+
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Fatalf("myers() does not turn %d lines into %d", len(a), len(b))
+	}
+
+	return edits
+}
+
+// commonLength returns the length of the longest common subsequence.
+func commonLength(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	return table[0][0]
+}
+
+func writeTestFile(t *testing.T, root, name, content string) {
+	t.Helper()
+
+	p := filepath.Join(root, name)
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build linux
+
+package overlay
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stat is what a file looked like when a manifest was taken. Size, mode and
+// modification time together tell a changed file apart without reading it.
+type Stat struct {
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+// Manifest maps the relative paths of the files and directories in a
+// directory to their stat, so later changes to it can be found.
+type Manifest map[string]Stat
+
+// NewManifest records every file and directory below dir except the .git
+// directory.
+func NewManifest(dir string) (Manifest, error) {
+	manifest := Manifest{}
+
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		manifest[rel] = statOf(info)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk directory")
+	}
+
+	return manifest, nil
+}
+
+// ReadManifest reads a manifest written by WriteManifest. A missing file
+// gives a nil manifest and no error.
+func ReadManifest(name string) (Manifest, error) {
+	buf, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read manifest")
+	}
+
+	var manifest Manifest
+
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return nil, errors.Wrap(err, "failed to parse manifest")
+	}
+
+	return manifest, nil
+}
+
+// WriteManifest stores manifest in name, replacing it atomically.
+func WriteManifest(name string, manifest Manifest) error {
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return errors.Wrap(err, "failed to write manifest")
+	}
+
+	tmp := name + ".tmp"
+
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		return errors.Wrap(err, "failed to write manifest")
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// Changed reports whether the file at rel below dir is not as recorded,
+// which includes files created or removed since.
+func (m Manifest) Changed(dir, rel string) bool {
+	old, recorded := m[rel]
+
+	info, err := os.Lstat(filepath.Join(dir, rel))
+	if err != nil {
+		return recorded
+	}
+
+	if !recorded {
+		return true
+	}
+
+	cur := statOf(info)
+
+	// Directory times change with their contents, only the type matters
+	if cur.Mode.IsDir() || old.Mode.IsDir() {
+		return cur.Mode.IsDir() != old.Mode.IsDir()
+	}
+
+	return cur.Size != old.Size || cur.Mode != old.Mode || !cur.ModTime.Equal(old.ModTime)
+}
+
+func statOf(info os.FileInfo) Stat {
+	return Stat{
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Usage summarizes how far an upper layer has grown from the lower layers.
+type Usage struct {
+	Size         int64
+	Added        int
+	Modified     int
+	Deleted      int
+	LastModified time.Time
+}
+
+// DiskUsage returns the size of the upper layer, when it was last written and
+// how many files it adds, modifies and deletes, with whiteouts and opaque
+// directories counted as deletions of what they hide. Files below .git are
+// left out of the counts, like apply leaves them out.
+func DiskUsage(upper string, lowers ...string) (Usage, error) {
+	var usage Usage
+
+	err := filepath.Walk(upper, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(usage.LastModified) {
+			usage.LastModified = info.ModTime()
+		}
+		if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 {
+			usage.Size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return usage, errors.Wrap(err, "failed to read upper directory")
+	}
+
+	changes, err := Changes(upper, lowers...)
+	if err != nil {
+		return usage, err
+	}
+
+	for _, item := range changes {
+		if InGitDir(item.Path) {
+			continue
+		}
+		switch item.Kind {
+		case Added:
+			usage.Added++
+		case Modified:
+			usage.Modified++
+		case Deleted:
+			usage.Deleted++
+		}
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package overlay
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskUsage(t *testing.T) {
+	lower := t.TempDir()
+	upper := t.TempDir()
+
+	write := func(root, name, content string) {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(lower, "edit", "old\n")
+	write(lower, "gone", "gone\n")
+	write(lower, "opq/a", "a\n")
+	write(lower, "opq/b", "b\n")
+	write(lower, ".git/HEAD", "ref: refs/heads/main\n")
+
+	write(upper, "edit", "new!\n")
+	write(upper, "fresh", "fresh\n")
+	write(upper, ".wh.gone", "")
+	write(upper, "opq/.wh..wh..opq", "")
+
+	// Commits inside the workspace take space but are no file changes
+	write(upper, ".git/HEAD", "abcd\n")
+	write(upper, ".git/index", "idx\n")
+
+	latest := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(upper, "fresh"), latest, latest); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := DiskUsage(upper, lower)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Usage{Size: 20, Added: 1, Modified: 1, Deleted: 3, LastModified: latest}
+	if usage.Size != want.Size || usage.Added != want.Added || usage.Modified != want.Modified ||
+		usage.Deleted != want.Deleted || !usage.LastModified.Equal(want.LastModified) {
+		t.Errorf("DiskUsage() = %+v, want %+v", usage, want)
+	}
+}
@@ -0,0 +1,250 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/config"
+)
+
+const (
+	anthropicBase      = "https://api.anthropic.com"
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 8192
+)
+
+// Anthropic talks to the Anthropic Messages API directly.
+type Anthropic struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	MaxTokens  int
+	HTTPClient *http.Client
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	MaxTokens int                `json:"max_tokens"`
+	Stream    bool               `json:"stream"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicEvent struct {
+	Type         string `json:"type"`
+	Index        int    `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewAnthropic(model config.Model) *Anthropic {
+	return &Anthropic{
+		BaseURL:    model.ApiBase,
+		APIKey:     model.ApiKey,
+		Model:      model.ModelId,
+		MaxTokens:  anthropicMaxTokens,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *Anthropic) Name() string {
+	return "anthropic"
+}
+
+// Stream converts messages to the Messages API format, streams the reply to
+// w and converts tool_use blocks back into tool calls.
+func (c *Anthropic) Stream(ctx context.Context, messages []Message, tools []ToolSpec, w io.Writer) (Message, error) {
+	req := anthropicRequest{
+		Model:     c.Model,
+		MaxTokens: c.MaxTokens,
+		Stream:    true,
+	}
+
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = anthropicMaxTokens
+	}
+
+	req.System, req.Messages = toAnthropicMessages(messages)
+
+	for _, item := range tools {
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        item.Function.Name,
+			Description: item.Function.Description,
+			InputSchema: item.Function.Parameters,
+		})
+	}
+
+	resp, err := post(ctx, c.HTTPClient, anthropicEndpoint(c.BaseURL), req, map[string]string{
+		"Accept":            "text/event-stream",
+		"X-Api-Key":         c.APIKey,
+		"Anthropic-Version": anthropicVersion,
+	})
+	if err != nil {
+		return Message{}, err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	return readAnthropicStream(ctx, resp.Body, w)
+}
+
+// toAnthropicMessages lifts system messages into the system prompt, turns
+// tool calls and results into content blocks and merges consecutive turns of
+// the same role, which the Messages API rejects.
+func toAnthropicMessages(messages []Message) (string, []anthropicMessage) {
+	var system []string
+	var list []anthropicMessage
+
+	for _, item := range messages {
+		var role string
+		var blocks []anthropicBlock
+
+		switch item.Role {
+		case RoleSystem:
+			system = append(system, item.Content)
+			continue
+		case RoleTool:
+			role = RoleUser
+			blocks = append(blocks, anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: item.ToolCallID,
+				Content:   item.Content,
+			})
+		case RoleAssistant:
+			role = RoleAssistant
+			if item.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: item.Content})
+			}
+			for _, call := range item.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if len(input) == 0 || !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: input,
+				})
+			}
+		default:
+			role = RoleUser
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: item.Content})
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(list); n > 0 && list[n-1].Role == role {
+			list[n-1].Content = append(list[n-1].Content, blocks...)
+			continue
+		}
+
+		list = append(list, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	return strings.Join(system, "\n\n"), list
+}
+
+func readAnthropicStream(ctx context.Context, r io.Reader, w io.Writer) (Message, error) {
+	var content strings.Builder
+	var calls []ToolCall
+
+	// Blocks are addressed by index, only tool_use blocks become calls
+	blocks := map[int]int{}
+
+	err := readLines(ctx, r, func(line string) (bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			return false, nil
+		}
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return false, errors.Wrap(err, "failed to parse stream")
+		}
+		switch event.Type {
+		case "error":
+			if event.Error != nil {
+				return false, errors.New(event.Error.Message)
+			}
+			return false, errors.New("stream failed")
+		case "message_stop":
+			return true, nil
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				var call ToolCall
+				call.ID = event.ContentBlock.ID
+				call.Type = "function"
+				call.Function.Name = event.ContentBlock.Name
+				blocks[event.Index] = len(calls)
+				calls = append(calls, call)
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				content.WriteString(event.Delta.Text)
+				if _, err := io.WriteString(w, event.Delta.Text); err != nil {
+					return false, err
+				}
+			case "input_json_delta":
+				if i, ok := blocks[event.Index]; ok {
+					calls[i].Function.Arguments += event.Delta.PartialJSON
+				}
+			}
+		}
+		return false, nil
+	})
+
+	return Message{
+		Role:      RoleAssistant,
+		Content:   content.String(),
+		ToolCalls: calls,
+	}, err
+}
+
+func anthropicEndpoint(base string) string {
+	return joinURL(base, anthropicBase, "/messages", "/v1")
+}
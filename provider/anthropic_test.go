@@ -0,0 +1,115 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Api-Key"); got != "secret" {
+			t.Errorf("unexpected api key %q", got)
+		}
+		if got := r.Header.Get("Anthropic-Version"); got != anthropicVersion {
+			t.Errorf("unexpected version %q", got)
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.System != "be brief" || len(req.Messages) != 1 || len(req.Tools) != 1 || req.MaxTokens == 0 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		events := []string{
+			`{"type":"message_start","message":{}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"look"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"read_file","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"a.txt\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_stop"}`,
+		}
+		for _, item := range events {
+			var event struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(item), &event)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, item)
+		}
+	}))
+	defer server.Close()
+
+	var spec ToolSpec
+	spec.Type = "function"
+	spec.Function.Name = "read_file"
+
+	messages := []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "hi"},
+	}
+
+	var out strings.Builder
+
+	reply, err := (&Anthropic{BaseURL: server.URL, APIKey: "secret", Model: "claude"}).Stream(context.Background(), messages, []ToolSpec{spec}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.Content != "Let me look" || out.String() != reply.Content {
+		t.Errorf("unexpected reply %q, output %q", reply.Content, out.String())
+	}
+
+	if len(reply.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got %+v", reply.ToolCalls)
+	}
+
+	call := reply.ToolCalls[0]
+	if call.ID != "toolu_1" || call.Function.Name != "read_file" || call.Function.Arguments != `{"path":"a.txt"}` {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+}
+
+func TestToAnthropicMessages(t *testing.T) {
+	call := ToolCall{ID: "toolu_1", Type: "function"}
+	call.Function.Name = "read_file"
+	call.Function.Arguments = `{"path":"a.txt"}`
+
+	system, list := toAnthropicMessages([]Message{
+		{Role: RoleSystem, Content: "one"},
+		{Role: RoleSystem, Content: "two"},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "reading", ToolCalls: []ToolCall{call}},
+		{Role: RoleTool, Content: "hello", ToolCallID: "toolu_1"},
+		{Role: RoleUser, Content: "thanks"},
+	})
+
+	if system != "one\n\ntwo" {
+		t.Errorf("unexpected system %q", system)
+	}
+
+	// The tool result and the following user turn are merged into one message
+	if len(list) != 3 {
+		t.Fatalf("expected 3 messages, got %+v", list)
+	}
+
+	if blocks := list[1].Content; len(blocks) != 2 || blocks[1].Type != "tool_use" || string(blocks[1].Input) != call.Function.Arguments {
+		t.Errorf("unexpected assistant blocks %+v", blocks)
+	}
+
+	if blocks := list[2].Content; list[2].Role != RoleUser || len(blocks) != 2 || blocks[0].Type != "tool_result" || blocks[0].ToolUseID != "toolu_1" {
+		t.Errorf("unexpected user blocks %+v", blocks)
+	}
+}
@@ -0,0 +1,175 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/config"
+)
+
+const (
+	ollamaBase = "http://localhost:11434"
+)
+
+// Ollama talks to the native /api/chat endpoint of a local model server,
+// which streams newline-delimited JSON instead of server-sent events.
+type Ollama struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ToolSpec      `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChunk struct {
+	Message ollamaMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error"`
+}
+
+func NewOllama(model config.Model) *Ollama {
+	return &Ollama{
+		BaseURL:    model.ApiBase,
+		APIKey:     model.ApiKey,
+		Model:      model.ModelId,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *Ollama) Name() string {
+	return "ollama"
+}
+
+// Stream sends messages and writes the reply text to w as chunks arrive.
+// Ollama passes tool arguments as objects and does not assign call IDs, so
+// both are converted to match the OpenAI shape used by the rest of chat.
+func (c *Ollama) Stream(ctx context.Context, messages []Message, tools []ToolSpec, w io.Writer) (Message, error) {
+	headers := map[string]string{}
+
+	if c.APIKey != "" {
+		headers["Authorization"] = "Bearer " + c.APIKey
+	}
+
+	resp, err := post(ctx, c.HTTPClient, ollamaEndpoint(c.BaseURL), ollamaRequest{
+		Model:    c.Model,
+		Messages: toOllamaMessages(messages),
+		Tools:    tools,
+		Stream:   true,
+	}, headers)
+	if err != nil {
+		return Message{}, err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	return readOllamaStream(ctx, resp.Body, w)
+}
+
+func toOllamaMessages(messages []Message) []ollamaMessage {
+	names := map[string]string{}
+
+	list := make([]ollamaMessage, 0, len(messages))
+
+	for _, item := range messages {
+		msg := ollamaMessage{
+			Role:    item.Role,
+			Content: item.Content,
+		}
+
+		for _, call := range item.ToolCalls {
+			var tc ollamaToolCall
+			tc.Function.Name = call.Function.Name
+			tc.Function.Arguments = json.RawMessage(call.Function.Arguments)
+			if len(tc.Function.Arguments) == 0 || !json.Valid(tc.Function.Arguments) {
+				tc.Function.Arguments = json.RawMessage("{}")
+			}
+			names[call.ID] = call.Function.Name
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+
+		if item.Role == RoleTool {
+			msg.ToolName = names[item.ToolCallID]
+		}
+
+		list = append(list, msg)
+	}
+
+	return list
+}
+
+func readOllamaStream(ctx context.Context, r io.Reader, w io.Writer) (Message, error) {
+	var content strings.Builder
+	var calls []ToolCall
+
+	// IDs only need to be unique within a conversation to pair results
+	prefix := fmt.Sprintf("call_%x", time.Now().UnixNano())
+
+	err := readLines(ctx, r, func(line string) (bool, error) {
+		if strings.TrimSpace(line) == "" {
+			return false, nil
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return false, errors.Wrap(err, "failed to parse stream")
+		}
+		if chunk.Error != "" {
+			return false, errors.New(chunk.Error)
+		}
+		for _, item := range chunk.Message.ToolCalls {
+			var call ToolCall
+			call.ID = fmt.Sprintf("%s_%d", prefix, len(calls)+1)
+			call.Type = "function"
+			call.Function.Name = item.Function.Name
+			call.Function.Arguments = string(item.Function.Arguments)
+			calls = append(calls, call)
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if _, err := io.WriteString(w, chunk.Message.Content); err != nil {
+				return false, err
+			}
+		}
+		return chunk.Done, nil
+	})
+
+	return Message{
+		Role:      RoleAssistant,
+		Content:   content.String(),
+		ToolCalls: calls,
+	}, err
+}
+
+func ollamaEndpoint(base string) string {
+	return joinURL(base, ollamaBase, "/api/chat", "")
+}
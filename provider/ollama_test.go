@@ -0,0 +1,58 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Model != "llama3" || !req.Stream || len(req.Messages) != 1 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		chunks := []string{
+			`{"message":{"role":"assistant","content":"Hel"},"done":false}`,
+			`{"message":{"role":"assistant","content":"lo"},"done":false}`,
+			`{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"read_file","arguments":{"path":"a.txt"}}}]},"done":false}`,
+			`{"message":{"role":"assistant","content":""},"done":true}`,
+		}
+		for _, item := range chunks {
+			_, _ = fmt.Fprintln(w, item)
+		}
+	}))
+	defer server.Close()
+
+	var out strings.Builder
+
+	reply, err := (&Ollama{BaseURL: server.URL, Model: "llama3"}).Stream(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.Content != "Hello" || out.String() != reply.Content {
+		t.Errorf("unexpected reply %q, output %q", reply.Content, out.String())
+	}
+
+	if len(reply.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got %+v", reply.ToolCalls)
+	}
+
+	call := reply.ToolCalls[0]
+	if call.ID == "" || call.Function.Name != "read_file" || call.Function.Arguments != `{"path":"a.txt"}` {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+}
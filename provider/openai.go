@@ -0,0 +1,153 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/config"
+)
+
+const (
+	openaiBase = "https://api.openai.com"
+)
+
+// OpenAI talks to an OpenAI-compatible /v1/chat/completions endpoint such as
+// the one exposed by LiteLLM.
+type OpenAI struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+type openaiRequest struct {
+	Model    string     `json:"model"`
+	Messages []Message  `json:"messages"`
+	Tools    []ToolSpec `json:"tools,omitempty"`
+	Stream   bool       `json:"stream"`
+}
+
+type openaiChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewOpenAI(model config.Model) *OpenAI {
+	return &OpenAI{
+		BaseURL:    model.ApiBase,
+		APIKey:     model.ApiKey,
+		Model:      model.ModelId,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *OpenAI) Name() string {
+	return "openai"
+}
+
+// Stream sends messages and writes the reply text to w as server-sent events
+// arrive, returning the assembled assistant message, including any tool
+// calls, once the stream ends.
+func (c *OpenAI) Stream(ctx context.Context, messages []Message, tools []ToolSpec, w io.Writer) (Message, error) {
+	headers := map[string]string{
+		"Accept": "text/event-stream",
+	}
+
+	if c.APIKey != "" {
+		headers["Authorization"] = "Bearer " + c.APIKey
+	}
+
+	resp, err := post(ctx, c.HTTPClient, openaiEndpoint(c.BaseURL), openaiRequest{
+		Model:    c.Model,
+		Messages: messages,
+		Tools:    tools,
+		Stream:   true,
+	}, headers)
+	if err != nil {
+		return Message{}, err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	return readOpenAIStream(ctx, resp.Body, w)
+}
+
+func readOpenAIStream(ctx context.Context, r io.Reader, w io.Writer) (Message, error) {
+	var content strings.Builder
+	var calls []ToolCall
+
+	err := readLines(ctx, r, func(line string) (bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			return false, nil
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return true, nil
+		}
+		var chunk openaiChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, errors.Wrap(err, "failed to parse stream")
+		}
+		if chunk.Error != nil {
+			return false, errors.New(chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			// Tool call fragments arrive keyed by index and are concatenated
+			for _, delta := range choice.Delta.ToolCalls {
+				for len(calls) <= delta.Index {
+					calls = append(calls, ToolCall{Type: "function"})
+				}
+				call := &calls[delta.Index]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				call.Function.Name += delta.Function.Name
+				call.Function.Arguments += delta.Function.Arguments
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if _, err := io.WriteString(w, choice.Delta.Content); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+
+	return Message{
+		Role:      RoleAssistant,
+		Content:   content.String(),
+		ToolCalls: calls,
+	}, err
+}
+
+func openaiEndpoint(base string) string {
+	return joinURL(base, openaiBase, "/chat/completions", "/v1")
+}
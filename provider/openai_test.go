@@ -0,0 +1,165 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAIStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		var req openaiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Model != "anthropic/claude" || !req.Stream || len(req.Messages) != 1 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, item := range []string{"Hello", ", ", "world"} {
+			_, _ = fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", item)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := &OpenAI{BaseURL: server.URL, APIKey: "secret", Model: "anthropic/claude"}
+
+	var out strings.Builder
+
+	reply, err := client.Stream(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.Content != "Hello, world" || out.String() != reply.Content {
+		t.Errorf("unexpected reply %q, output %q", reply.Content, out.String())
+	}
+}
+
+func TestOpenAIStreamHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = fmt.Fprint(w, `{"error":{"message":"invalid api key"}}`)
+	}))
+	defer server.Close()
+
+	client := &OpenAI{BaseURL: server.URL + "/v1", Model: "m"}
+
+	_, err := client.Stream(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, nil, &strings.Builder{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected APIError, got %v", err)
+	}
+
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "invalid api key" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestOpenAIStreamCancel(t *testing.T) {
+	done := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"partial\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var out strings.Builder
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	reply, err := (&OpenAI{BaseURL: server.URL, Model: "m"}).Stream(ctx, []Message{{Role: RoleUser, Content: "hi"}}, nil, &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if reply.Content != "partial" {
+		t.Errorf("unexpected reply %q", reply.Content)
+	}
+}
+
+func TestOpenAIStreamToolCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openaiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Function.Name != "read_file" {
+			t.Errorf("unexpected tools %+v", req.Tools)
+		}
+		chunks := []string{
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a.txt\"}"}}]}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		}
+		for _, item := range chunks {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", item)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var spec ToolSpec
+	spec.Type = "function"
+	spec.Function.Name = "read_file"
+
+	reply, err := (&OpenAI{BaseURL: server.URL, Model: "m"}).Stream(context.Background(), []Message{{Role: RoleUser, Content: "hi"}}, []ToolSpec{spec}, &strings.Builder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reply.ToolCalls) != 1 {
+		t.Fatalf("expected one tool call, got %+v", reply.ToolCalls)
+	}
+
+	call := reply.ToolCalls[0]
+	if call.ID != "call_1" || call.Function.Name != "read_file" || call.Function.Arguments != `{"path":"a.txt"}` {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"http://localhost:4000", "http://localhost:4000/v1/chat/completions"},
+		{"http://localhost:4000/", "http://localhost:4000/v1/chat/completions"},
+		{"https://api.openai.com/v1", "https://api.openai.com/v1/chat/completions"},
+		{"http://gw/v1/chat/completions", "http://gw/v1/chat/completions"},
+	}
+
+	for _, tt := range tests {
+		if got := openaiEndpoint(tt.base); got != tt.want {
+			t.Errorf("openaiEndpoint(%q) = %q, want %q", tt.base, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+//go:build linux
+
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/config"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is a chat turn in OpenAI format, which every provider converts
+// from and to its own wire format.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ToolSpec advertises a callable function to the model.
+type ToolSpec struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+// Provider streams a chat completion, writing reply text to w as it arrives
+// and returning the assembled assistant message.
+type Provider interface {
+	Name() string
+	Stream(ctx context.Context, messages []Message, tools []ToolSpec, w io.Writer) (Message, error)
+}
+
+// APIError is returned when the endpoint answers with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("chat completion failed: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("chat completion failed: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// New selects the implementation by provider_name. Anything that is not
+// anthropic or ollama is assumed to speak the OpenAI chat completions API,
+// which covers LiteLLM and most gateways.
+func New(model config.Model) (Provider, error) {
+	switch strings.ToLower(model.ProviderName) {
+	case "anthropic":
+		if model.ApiKey == "" {
+			return nil, errors.New("no api key found\n")
+		}
+		return NewAnthropic(model), nil
+	case "ollama":
+		return NewOllama(model), nil
+	default:
+		if model.ApiBase == "" && !strings.EqualFold(model.ProviderName, "openai") {
+			return nil, errors.New("no api base found\n")
+		}
+		if model.ApiKey == "" {
+			return nil, errors.New("no api key found\n")
+		}
+		return NewOpenAI(model), nil
+	}
+}
+
+func newAPIError(resp *http.Response) error {
+	buf, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	message := strings.TrimSpace(string(buf))
+
+	// OpenAI and Anthropic nest the message, Ollama returns a plain string
+	var nested struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	var plain struct {
+		Error string `json:"error"`
+	}
+
+	if err := json.Unmarshal(buf, &nested); err == nil && nested.Error.Message != "" {
+		message = nested.Error.Message
+	} else if err := json.Unmarshal(buf, &plain); err == nil && plain.Error != "" {
+		message = plain.Error
+	}
+
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+	}
+}
+
+func post(ctx context.Context, client *http.Client, url string, body any, headers map[string]string) (*http.Response, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(buf)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, val := range headers {
+		req.Header.Set(key, val)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.Wrap(err, "failed to send request")
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer func(body io.ReadCloser) {
+			_ = body.Close()
+		}(resp.Body)
+		return nil, newAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// readLines calls fn for every line of a streamed body until fn reports done
+// or the body ends.
+func readLines(ctx context.Context, r io.Reader, fn func(line string) (bool, error)) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "failed to read stream")
+		}
+
+		if done, fnErr := fn(strings.TrimRight(line, "\r\n")); fnErr != nil || done {
+			return fnErr
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
+
+func joinURL(base, defaultBase, suffix, version string) string {
+	if base == "" {
+		base = defaultBase
+	}
+
+	base = strings.TrimRight(base, "/")
+
+	if strings.HasSuffix(base, suffix) {
+		return base
+	}
+
+	if version != "" && !strings.HasSuffix(base, version) {
+		base += version
+	}
+
+	return base + suffix
+}
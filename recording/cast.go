@@ -0,0 +1,200 @@
+//go:build linux
+
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	castVersion = 2
+
+	EventOutput = "o"
+	EventResize = "r"
+)
+
+// Header is the first line of a cast in the asciinema v2 format, see
+// https://docs.asciinema.org/manual/asciicast/v2/.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is one line after the header: what happened, at how many seconds
+// into the session.
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	// Microseconds are all the precision players use
+	return json.Marshal([]any{math.Round(e.Time*1e6) / 1e6, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(buf []byte) error {
+	var fields []json.RawMessage
+
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return err
+	}
+
+	if len(fields) != 3 {
+		return errors.Errorf("event has %d fields, expected 3", len(fields))
+	}
+
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// CastWriter writes a cast as the session goes. It is safe for concurrent
+// use, as output and resizes come from different goroutines.
+type CastWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	start   time.Time
+	pending []byte
+}
+
+// NewCastWriter writes header to w and times the events from now on.
+func NewCastWriter(w io.Writer, header Header) (*CastWriter, error) {
+	header.Version = castVersion
+
+	buf, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append(buf, '\n')); err != nil {
+		return nil, errors.Wrap(err, "failed to write cast header")
+	}
+
+	return &CastWriter{w: w, start: time.Now()}, nil
+}
+
+// Output records what the terminal showed. A character split between two
+// reads is held back until it is complete, as the data has to be UTF-8.
+func (c *CastWriter) Output(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf := append(c.pending, data...)
+	cut := incomplete(buf)
+
+	c.pending = append([]byte(nil), buf[cut:]...)
+
+	if cut == 0 {
+		return nil
+	}
+
+	return c.write(EventOutput, string(buf[:cut]))
+}
+
+// Resize records a new size of the terminal.
+func (c *CastWriter) Resize(width, height int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.write(EventResize, fmt.Sprintf("%dx%d", width, height))
+}
+
+func (c *CastWriter) write(kind, data string) error {
+	buf, err := json.Marshal(Event{Time: time.Since(c.start).Seconds(), Type: kind, Data: data})
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.w.Write(append(buf, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write cast")
+	}
+
+	return nil
+}
+
+// incomplete returns where a trailing partial UTF-8 sequence of buf starts,
+// or len(buf) if there is none.
+func incomplete(buf []byte) int {
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if !utf8.FullRune(buf[i:]) {
+				return i
+			}
+			break
+		}
+	}
+
+	return len(buf)
+}
+
+// CastReader reads the events of a cast one by one.
+type CastReader struct {
+	Header Header
+	r      *bufio.Reader
+}
+
+// NewCastReader reads the header of the cast in r.
+func NewCastReader(r io.Reader) (*CastReader, error) {
+	c := &CastReader{r: bufio.NewReader(r)}
+
+	line, err := c.r.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, errors.Wrap(err, "failed to read cast header")
+	}
+
+	if err := json.Unmarshal(line, &c.Header); err != nil {
+		return nil, errors.Wrap(err, "failed to parse cast header")
+	}
+
+	if c.Header.Version != castVersion {
+		return nil, errors.Errorf("unsupported cast version %d", c.Header.Version)
+	}
+
+	return c, nil
+}
+
+// Next returns the next event, or io.EOF after the last one. A line cut off
+// by a session that was killed ends the cast as well.
+func (c *CastReader) Next() (Event, error) {
+	var event Event
+
+	for {
+		line, readErr := c.r.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return event, errors.Wrap(readErr, "failed to read cast")
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			err := json.Unmarshal(line, &event)
+			if err == nil {
+				return event, nil
+			}
+			if readErr == nil {
+				return event, errors.Wrap(err, "failed to parse cast event")
+			}
+		}
+		if readErr == io.EOF {
+			return event, io.EOF
+		}
+	}
+}
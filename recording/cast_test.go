@@ -0,0 +1,114 @@
+//go:build linux
+
+package recording
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCast(t *testing.T) {
+	var buf bytes.Buffer
+
+	writer, err := NewCastWriter(&buf, Header{Width: 120, Height: 40, Title: "ws"})
+	if err != nil {
+		t.Fatalf("NewCastWriter failed: %v", err)
+	}
+
+	// "é" split between two reads
+	if err := writer.Output([]byte("caf\xc3")); err != nil {
+		t.Fatalf("Output failed: %v", err)
+	}
+	if err := writer.Output([]byte("\xa9\r\n")); err != nil {
+		t.Fatalf("Output failed: %v", err)
+	}
+	if err := writer.Resize(100, 30); err != nil {
+		t.Fatalf("Resize failed: %v", err)
+	}
+
+	reader, err := NewCastReader(&buf)
+	if err != nil {
+		t.Fatalf("NewCastReader failed: %v", err)
+	}
+
+	if reader.Header.Version != castVersion || reader.Header.Width != 120 || reader.Header.Height != 40 || reader.Header.Title != "ws" {
+		t.Errorf("header = %+v", reader.Header)
+	}
+
+	want := []Event{
+		{Type: EventOutput, Data: "caf"},
+		{Type: EventOutput, Data: "é\r\n"},
+		{Type: EventResize, Data: "100x30"},
+	}
+
+	for _, item := range want {
+		event, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if event.Type != item.Type || event.Data != item.Data {
+			t.Errorf("Next() = %q %q, want %q %q", event.Type, event.Data, item.Type, item.Data)
+		}
+	}
+
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next() after last event = %v, want EOF", err)
+	}
+}
+
+func TestCastTruncated(t *testing.T) {
+	input := `{"version":2,"width":80,"height":24}` + "\n" +
+		`[0.5,"o","ls\r\n"]` + "\n" +
+		`[1.25,"o","RE`
+
+	reader, err := NewCastReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("NewCastReader failed: %v", err)
+	}
+
+	event, err := reader.Next()
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if event.Time != 0.5 || event.Data != "ls\r\n" {
+		t.Errorf("Next() = %+v", event)
+	}
+
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Next() on cut off line = %v, want EOF", err)
+	}
+
+	if _, err := NewCastReader(strings.NewReader(`{"version":1}` + "\n")); err == nil {
+		t.Error("NewCastReader of version 1 succeeded, want error")
+	}
+}
+
+func TestParseCommands(t *testing.T) {
+	input := "1700000000\tgit status\n" +
+		"garbage\n" +
+		"x\tls\n" +
+		"1700000005\techo 'a\tb'\n"
+
+	commands, err := parseCommands(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseCommands failed: %v", err)
+	}
+
+	want := []Command{
+		{Time: time.Unix(1700000000, 0), Line: "git status"},
+		{Time: time.Unix(1700000005, 0), Line: "echo 'a\tb'"},
+	}
+
+	if len(commands) != len(want) {
+		t.Fatalf("parseCommands() = %v, want %v", commands, want)
+	}
+
+	for i := range want {
+		if !commands[i].Time.Equal(want[i].Time) || commands[i].Line != want[i].Line {
+			t.Errorf("parseCommands()[%d] = %v, want %v", i, commands[i], want[i])
+		}
+	}
+}
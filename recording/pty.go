@@ -0,0 +1,110 @@
+//go:build linux
+
+package recording
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// openPty returns the master and the slave of a new pseudo-terminal.
+func openPty() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open pty")
+	}
+
+	var n uint32
+
+	err = control(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return err
+		}
+		var err error
+		n, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+		return err
+	})
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, errors.Wrap(err, "failed to unlock pty")
+	}
+
+	slave, err = os.OpenFile("/dev/pts/"+strconv.FormatUint(uint64(n), 10), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, errors.Wrap(err, "failed to open pty")
+	}
+
+	return master, slave, nil
+}
+
+// control runs fn on the descriptor of file without putting it into blocking
+// mode, as File.Fd does, so a pending Read still returns on Close.
+func control(file *os.File, fn func(fd int) error) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+
+	if err := conn.Control(func(fd uintptr) {
+		fnErr = fn(int(fd))
+	}); err != nil {
+		return err
+	}
+
+	return fnErr
+}
+
+// size returns the size of the terminal on fd, or 80x24 if it is none.
+func size(fd int) (width, height int) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return defaultWidth, defaultHeight
+	}
+
+	return int(ws.Col), int(ws.Row)
+}
+
+func resize(pty *os.File, width, height int) error {
+	return control(pty, func(fd int) error {
+		return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Col: uint16(width), Row: uint16(height)})
+	})
+}
+
+// makeRaw puts the terminal on fd into raw mode, so every key goes to the
+// pseudo-terminal as it is, and returns how to restore it. Nothing is done
+// if fd is no terminal.
+func makeRaw(fd int) (restore func(), err error) {
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return func() {}, nil
+	}
+
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to set terminal to raw mode")
+	}
+
+	return func() {
+		_ = unix.IoctlSetTermios(fd, unix.TCSETS, old)
+	}, nil
+}
@@ -0,0 +1,400 @@
+//go:build linux
+
+// Package recording records terminal sessions in workspaces as asciinema v2
+// casts, with an index of the commands run in them, and plays them back.
+package recording
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	castExt  = ".cast"
+	indexExt = ".commands"
+
+	// drainTimeout bounds the wait for the last output once the command
+	// exited, when something it left running keeps the terminal open
+	drainTimeout = time.Second
+)
+
+// Recording is a recorded session, stored in a directory as ID.cast and the
+// command index ID.commands.
+type Recording struct {
+	ID        string
+	Workspace string
+	StartedAt time.Time
+	Duration  time.Duration
+	Commands  int
+
+	// Index is where the shell writes the commands it runs, one per line as
+	// the Unix time it was entered, a tab and the command line
+	Index *os.File
+
+	dir string
+}
+
+// Command is an entry of the command index.
+type Command struct {
+	Time time.Time
+	Line string
+}
+
+// Create starts a recording of workspace in dir.
+func Create(dir, workspace string) (*Recording, error) {
+	if err := os.MkdirAll(dir, utils.PermDir); err != nil {
+		return nil, errors.Wrap(err, "failed to create recording directory")
+	}
+
+	now := time.Now()
+
+	r := &Recording{
+		ID:        newRecordingID(now),
+		Workspace: workspace,
+		StartedAt: now,
+		dir:       dir,
+	}
+
+	index, err := os.OpenFile(path.Join(dir, r.ID+indexExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, utils.PermFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create command index")
+	}
+
+	r.Index = index
+
+	return r, nil
+}
+
+// Load reads the recording id in dir.
+func Load(dir, id string) (*Recording, error) {
+	if id == "" || strings.ContainsAny(id, "/\\") {
+		return nil, errors.Errorf("invalid session %q", id)
+	}
+
+	file, err := os.Open(path.Join(dir, id+castExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("session %s not found", id)
+		}
+		return nil, errors.Wrap(err, "failed to read session")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	reader, err := NewCastReader(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read session %s", id)
+	}
+
+	r := &Recording{
+		ID:        id,
+		Workspace: reader.Header.Title,
+		StartedAt: time.Unix(reader.Header.Timestamp, 0),
+		dir:       dir,
+	}
+
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read session %s", id)
+		}
+		r.Duration = time.Duration(event.Time * float64(time.Second))
+	}
+
+	commands, err := r.ReadCommands()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Commands = len(commands)
+
+	return r, nil
+}
+
+// List returns the recordings in dir, most recent first.
+func List(dir string) ([]*Recording, error) {
+	var list []*Recording
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, item := range entries {
+		id, ok := strings.CutSuffix(item.Name(), castExt)
+		if !ok || item.IsDir() {
+			continue
+		}
+		r, err := Load(dir, id)
+		if err != nil {
+			continue
+		}
+		list = append(list, r)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+
+	return list, nil
+}
+
+// Run runs cmd on a new pseudo-terminal in place of the terminal of this
+// process, which it passes keys and output through to, and records what it
+// shows. Any SysProcAttr of cmd is kept, and cmd gets its own session with
+// the pseudo-terminal as controlling terminal.
+func (r *Recording) Run(cmd *exec.Cmd) (err error) {
+	defer func() {
+		_ = r.Index.Close()
+	}()
+
+	master, slave, err := openPty()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = master.Close()
+	}()
+
+	width, height := size(int(os.Stdout.Fd()))
+
+	if err := resize(master, width, height); err != nil {
+		_ = slave.Close()
+		return errors.Wrap(err, "failed to resize pty")
+	}
+
+	file, err := os.OpenFile(path.Join(r.dir, r.ID+castExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, utils.PermFile)
+	if err != nil {
+		_ = slave.Close()
+		return errors.Wrap(err, "failed to create cast")
+	}
+
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = errors.Wrap(closeErr, "failed to write cast")
+		}
+	}()
+
+	cast, err := NewCastWriter(file, Header{
+		Width:     width,
+		Height:    height,
+		Timestamp: r.StartedAt.Unix(),
+		Title:     r.Workspace,
+		Env: map[string]string{
+			"SHELL": os.Getenv("SHELL"),
+			"TERM":  os.Getenv("TERM"),
+		},
+	})
+	if err != nil {
+		_ = slave.Close()
+		return err
+	}
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		_ = slave.Close()
+		return err
+	}
+
+	defer restore()
+
+	err = cmd.Start()
+	_ = slave.Close()
+
+	if err != nil {
+		return err
+	}
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	go func() {
+		for range winch {
+			width, height := size(int(os.Stdout.Fd()))
+			if resize(master, width, height) == nil {
+				_ = cast.Resize(width, height)
+			}
+		}
+	}()
+
+	go func() {
+		_, _ = io.Copy(master, os.Stdin)
+	}()
+
+	var castErr error
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := master.Read(buf)
+			if n > 0 {
+				_, _ = os.Stdout.Write(buf[:n])
+				if err := cast.Output(buf[:n]); err != nil && castErr == nil {
+					castErr = err
+				}
+			}
+			if err != nil {
+				// EIO once the last process holding the terminal exited
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		_ = master.Close()
+		<-done
+	}
+
+	if err == nil {
+		err = castErr
+	}
+
+	return err
+}
+
+// ReadCommands returns the command index of the recording.
+func (r *Recording) ReadCommands() ([]Command, error) {
+	file, err := os.Open(path.Join(r.dir, r.ID+indexExt))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read command index")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	return parseCommands(file)
+}
+
+func parseCommands(r io.Reader) ([]Command, error) {
+	var commands []Command
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		stamp, line, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		sec, err := strconv.ParseInt(stamp, 10, 64)
+		if err != nil {
+			continue
+		}
+		commands = append(commands, Command{Time: time.Unix(sec, 0), Line: line})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read command index")
+	}
+
+	return commands, nil
+}
+
+// Play writes the output of the recording to w as it was shown, speed times
+// as fast and with pauses cut to idle if it is not zero.
+func (r *Recording) Play(ctx context.Context, w io.Writer, speed float64, idle time.Duration) error {
+	file, err := os.Open(path.Join(r.dir, r.ID+castExt))
+	if err != nil {
+		return errors.Wrap(err, "failed to read session")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	reader, err := NewCastReader(file)
+	if err != nil {
+		return err
+	}
+
+	var last float64
+
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if event.Type != EventOutput {
+			continue
+		}
+
+		delay := time.Duration((event.Time - last) * float64(time.Second))
+		last = event.Time
+
+		if idle > 0 && delay > idle {
+			delay = idle
+		}
+
+		timer := time.NewTimer(time.Duration(float64(delay) / speed))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if _, err := io.WriteString(w, event.Data); err != nil {
+			return err
+		}
+	}
+}
+
+func newRecordingID(now time.Time) string {
+	buf := make([]byte, 2)
+	_, _ = rand.Read(buf)
+
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,223 @@
+//go:build linux
+
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	registryName = "workspaces.json"
+	stateName    = "workspaces"
+)
+
+// Entry records everything needed to find, remount, and tear down a workspace
+// without re-deriving it from the mount table.
+type Entry struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	Mount     string    `json:"mount"`
+	LowerDirs []string  `json:"lowerdirs"`
+	UpperDir  string    `json:"upperdir"`
+	WorkDir   string    `json:"workdir"`
+	Backend   string    `json:"backend,omitempty"`
+	Sshfs     string    `json:"sshfs,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	AppliedAt time.Time `json:"applied_at,omitzero"`
+}
+
+// Registry is the persistent workspace state stored under $HOME/.repo-scm.
+type Registry struct {
+	path       string
+	Workspaces map[string]*Entry `json:"workspaces"`
+}
+
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(home, ".repo-scm", registryName), nil
+}
+
+func Open(name string) (*Registry, error) {
+	var err error
+
+	if name == "" {
+		if name, err = DefaultPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Registry{path: name}
+
+	err = r.withLock(func() error {
+		return r.load()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Registry) Path() string {
+	return r.path
+}
+
+// StateDir returns the directory holding per-workspace state such as
+// chat sessions, snapshots and recordings.
+func (r *Registry) StateDir(name string) string {
+	return path.Join(path.Dir(r.path), stateName, name)
+}
+
+func (r *Registry) Get(name string) (*Entry, bool) {
+	entry, ok := r.Workspaces[name]
+	if !ok {
+		return nil, false
+	}
+
+	e := *entry
+
+	return &e, true
+}
+
+func (r *Registry) List() []*Entry {
+	var entries []*Entry
+
+	for _, item := range r.Workspaces {
+		e := *item
+		entries = append(entries, &e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries
+}
+
+// Put adds or replaces an entry. The registry is re-read under lock first so
+// concurrent invocations of the tool do not lose each other's updates.
+func (r *Registry) Put(entry *Entry) error {
+	if entry == nil || entry.Name == "" {
+		return errors.New("workspace name is required")
+	}
+
+	return r.withLock(func() error {
+		if err := r.load(); err != nil {
+			return err
+		}
+		e := *entry
+		now := time.Now()
+		if old, ok := r.Workspaces[e.Name]; ok && e.CreatedAt.IsZero() {
+			e.CreatedAt = old.CreatedAt
+		}
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = now
+		}
+		e.UpdatedAt = now
+		r.Workspaces[e.Name] = &e
+		return r.save()
+	})
+}
+
+func (r *Registry) Remove(name string) error {
+	return r.withLock(func() error {
+		if err := r.load(); err != nil {
+			return err
+		}
+		if _, ok := r.Workspaces[name]; !ok {
+			return nil
+		}
+		delete(r.Workspaces, name)
+		return r.save()
+	})
+}
+
+func (r *Registry) load() error {
+	r.Workspaces = map[string]*Entry{}
+
+	buf, err := os.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to read registry")
+	}
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(buf, r); err != nil {
+		return errors.Wrapf(err, "failed to parse registry %s", r.path)
+	}
+
+	if r.Workspaces == nil {
+		r.Workspaces = map[string]*Entry{}
+	}
+
+	for name, item := range r.Workspaces {
+		item.Name = name
+	}
+
+	return nil
+}
+
+func (r *Registry) save() error {
+	buf, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+
+	if err := os.WriteFile(tmp, buf, utils.PermFile); err != nil {
+		return errors.Wrap(err, "failed to write registry")
+	}
+
+	if err := os.Rename(tmp, r.path); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "failed to write registry")
+	}
+
+	return nil
+}
+
+func (r *Registry) withLock(fn func() error) error {
+	if err := os.MkdirAll(path.Dir(r.path), utils.PermDir); err != nil {
+		return errors.Wrap(err, "failed to create registry directory")
+	}
+
+	file, err := os.OpenFile(r.path+".lock", os.O_CREATE|os.O_RDWR, utils.PermFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to open registry lock")
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.Wrap(err, "failed to lock registry")
+	}
+
+	defer func(file *os.File) {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	}(file)
+
+	return fn()
+}
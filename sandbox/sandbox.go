@@ -0,0 +1,462 @@
+//go:build linux
+
+// Package sandbox runs a command in its own mount, PID, IPC and optionally
+// network namespaces, where a single directory is writable and the rest of the
+// filesystem is read-only.
+//
+// The namespaces are set up by this binary itself: Wrap turns a command into
+// a re-execution of the running executable, which finds itself started as the
+// sandbox init with IsInit, prepares the mounts in Init and then runs the
+// command as its only child.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/repo-scm/git/mount"
+)
+
+const (
+	// initName is the argv[0] the sandbox init is started with
+	initName = "repo-scm-sandbox"
+	// specEnv passes the spec to the sandbox init
+	specEnv = "REPO_SCM_SANDBOX"
+)
+
+// Options describe the sandbox of a command.
+type Options struct {
+	// Writable is the only directory the command can write to
+	Writable string
+	// NoNetwork cuts the command off the network of the host, leaving it a
+	// loopback interface of its own
+	NoNetwork bool
+}
+
+// spec is what the sandbox init needs to know about the wrapped command.
+type spec struct {
+	Path     string   `json:"path"`
+	Args     []string `json:"args"`
+	Dir      string   `json:"dir"`
+	Writable string   `json:"writable"`
+	Files    int      `json:"files"`
+	UID      int      `json:"uid"`
+	GID      int      `json:"gid"`
+}
+
+// Wrap makes cmd run in a sandbox. It has to be called once cmd is set up
+// and before it is started, and keeps its stdio, extra files, environment and
+// context.
+func Wrap(cmd *exec.Cmd, opts Options) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	writable, err := filepath.Abs(opts.Writable)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve writable directory")
+	}
+
+	dir := cmd.Dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return errors.Wrap(err, "failed to get working directory")
+		}
+	}
+
+	buf, err := json.Marshal(spec{
+		Path:     cmd.Path,
+		Args:     cmd.Args,
+		Dir:      dir,
+		Writable: filepath.Clean(writable),
+		Files:    len(cmd.ExtraFiles),
+		UID:      os.Getuid(),
+		GID:      os.Getgid(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode sandbox spec")
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	flags := uintptr(unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWIPC)
+	if opts.NoNetwork {
+		flags |= unix.CLONE_NEWNET
+	}
+
+	attr := &syscall.SysProcAttr{
+		Cloneflags: flags,
+		Pdeathsig:  syscall.SIGKILL,
+	}
+
+	// Without root the namespaces need a user namespace, in which the init is
+	// root until it hands over to the command
+	if os.Geteuid() != 0 {
+		attr.Cloneflags |= unix.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	}
+
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{initName}
+	cmd.Dir = "/"
+	cmd.Env = append(env, specEnv+"="+string(buf))
+	cmd.SysProcAttr = attr
+
+	return nil
+}
+
+var (
+	probeOnce sync.Once
+	probeErr  error
+)
+
+// Available reports why no sandbox can be set up on this host, such as
+// unprivileged user namespaces being disabled, or nil if one can. The answer
+// is found by setting up a sandbox without a command, once per process.
+func Available() error {
+	probeOnce.Do(func() {
+		// No command makes the init return once the sandbox is set up
+		cmd := &exec.Cmd{}
+		if probeErr = Wrap(cmd, Options{Writable: os.TempDir()}); probeErr != nil {
+			return
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if msg := strings.TrimSpace(string(output)); msg != "" {
+				err = errors.New(msg)
+			}
+			probeErr = errors.Wrap(err, "sandbox not available")
+		}
+	})
+
+	return probeErr
+}
+
+// IsInit reports whether this process was started by Wrap as sandbox init.
+func IsInit() bool {
+	return len(os.Args) > 0 && os.Args[0] == initName && os.Getenv(specEnv) != ""
+}
+
+// Init sets up the sandbox, runs the wrapped command in it and returns its
+// exit code, or 128 plus the signal that killed it. The init runs as PID 1 of
+// the new PID namespace, so everything the command leaves running is killed
+// when it returns.
+func Init() (int, error) {
+	var s spec
+
+	if err := json.Unmarshal([]byte(os.Getenv(specEnv)), &s); err != nil {
+		return 0, errors.Wrap(err, "failed to decode sandbox spec")
+	}
+
+	_ = os.Unsetenv(specEnv)
+
+	if err := setup(s.Writable); err != nil {
+		return 0, err
+	}
+
+	if s.Path == "" {
+		return 0, nil
+	}
+
+	cmd := &exec.Cmd{
+		Path:   s.Path,
+		Args:   s.Args,
+		Dir:    s.Dir,
+		Env:    os.Environ(),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	// The extra files of the wrapped command were passed on to the init
+	for i := 0; i < s.Files; i++ {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, os.NewFile(uintptr(3+i), ""))
+	}
+
+	// The command gets a user namespace of its own as well, which locks the
+	// read-only mounts so it cannot remount them writable, or unmount them to
+	// reveal what is below
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 unix.CLONE_NEWUSER | unix.CLONE_NEWNS,
+		UidMappings:                idMap(s.UID),
+		GidMappings:                idMap(s.GID),
+		GidMappingsEnableSetgroups: s.UID == 0,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, unix.SIGINT, unix.SIGTERM, unix.SIGHUP, unix.SIGQUIT, unix.SIGUSR1, unix.SIGUSR2)
+	defer signal.Stop(sigChan)
+
+	if err := cmd.Start(); err != nil {
+		return 0, errors.Wrapf(err, "failed to run %s in sandbox", s.Path)
+	}
+
+	go func() {
+		for sig := range sigChan {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	return reap(cmd.Process.Pid)
+}
+
+// idMap maps the user the command was started by to itself. Root is in the
+// initial user namespace and can map everyone, others only themselves.
+func idMap(id int) []syscall.SysProcIDMap {
+	if id == 0 {
+		return []syscall.SysProcIDMap{{ContainerID: 0, HostID: 0, Size: 1<<32 - 1}}
+	}
+
+	return []syscall.SysProcIDMap{{ContainerID: id, HostID: 0, Size: 1}}
+}
+
+// reap waits for every child, as orphans of the namespace are handed to its
+// PID 1, until the command with pid exits.
+func reap(pid int) (int, error) {
+	for {
+		var status unix.WaitStatus
+
+		child, err := unix.Wait4(-1, &status, 0, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to wait for sandboxed command")
+		}
+
+		if child != pid {
+			continue
+		}
+
+		if status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+
+		return status.ExitStatus(), nil
+	}
+}
+
+// setup turns the copy of the host mounts in the new mount namespace into the
+// sandbox: everything but writable read-only, a private /tmp, a minimal /dev
+// and a /proc of the new PID namespace.
+func setup(writable string) error {
+	// Nothing done here may propagate back to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return &mount.Error{Op: "make private", Target: "/", Err: err}
+	}
+
+	// A mount of its own keeps writable apart from the filesystem it is on,
+	// which is made read-only below
+	if err := unix.Mount(writable, writable, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return &mount.Error{Op: "bind", Target: writable, Err: err}
+	}
+
+	mounts, err := mount.Mounts()
+	if err != nil {
+		return err
+	}
+
+	var denied []string
+
+	for _, item := range mounts {
+		if isBelow(item.Mountpoint, writable) || isBelow(item.Mountpoint, "/dev") || isBelow(item.Mountpoint, "/proc") {
+			continue
+		}
+		err := remountReadOnly(&item)
+		if errors.Is(err, unix.EACCES) {
+			denied = append(denied, item.Mountpoint)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(denied) != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: no access to remount read-only, left as they are: %s\n", strings.Join(denied, ", "))
+	}
+
+	// Shadowing /tmp would hide a workspace mounted below it
+	if !isBelow(writable, "/tmp") {
+		if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return &mount.Error{Op: "mount tmpfs", Target: "/tmp", Err: err}
+		}
+	}
+
+	if err := setupDev(); err != nil {
+		return err
+	}
+
+	// Mounting proc is refused where parts of the host one are masked, like
+	// in containers, and the host one is still usable then
+	_ = unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+
+	return loopbackUp()
+}
+
+// devNodes are the devices of the host found in the /dev of the sandbox.
+var devNodes = []string{"null", "zero", "full", "random", "urandom", "tty", "ptmx"}
+
+// devLinks are the symlinks found in the /dev of the sandbox.
+var devLinks = map[string]string{
+	"fd":     "/proc/self/fd",
+	"stdin":  "/proc/self/fd/0",
+	"stdout": "/proc/self/fd/1",
+	"stderr": "/proc/self/fd/2",
+}
+
+// setupDev replaces /dev with a read-only tmpfs holding only the devices a
+// command needs, the terminals of the host, and a private /dev/shm and
+// /dev/mqueue, so no disk is reachable through it, not even for root.
+func setupDev() error {
+	// The devices of the host are bound in through a handle of the /dev the
+	// tmpfs is about to hide
+	fd, err := unix.Open("/dev", unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrap(err, "failed to open /dev")
+	}
+
+	defer func() {
+		_ = unix.Close(fd)
+	}()
+
+	host := fmt.Sprintf("/proc/self/fd/%d", fd)
+
+	if err := unix.Mount("tmpfs", "/dev", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=0755"); err != nil {
+		return &mount.Error{Op: "mount tmpfs", Target: "/dev", Err: err}
+	}
+
+	for _, name := range devNodes {
+		target := filepath.Join("/dev", name)
+		if err := os.WriteFile(target, nil, 0o666); err != nil {
+			return errors.Wrapf(err, "failed to create %s", target)
+		}
+		err := unix.Mount(filepath.Join(host, name), target, "", unix.MS_BIND, "")
+		if errors.Is(err, unix.ENOENT) {
+			_ = os.Remove(target)
+			continue
+		}
+		if err != nil {
+			return &mount.Error{Op: "bind", Target: target, Err: err}
+		}
+	}
+
+	for _, name := range []string{"pts", "shm", "mqueue"} {
+		if err := os.Mkdir(filepath.Join("/dev", name), 0o755); err != nil {
+			return errors.Wrapf(err, "failed to create /dev/%s", name)
+		}
+	}
+
+	// The terminal of the command is one of the host
+	if err := unix.Mount(filepath.Join(host, "pts"), "/dev/pts", "", unix.MS_BIND, ""); err != nil && !errors.Is(err, unix.ENOENT) {
+		return &mount.Error{Op: "bind", Target: "/dev/pts", Err: err}
+	}
+
+	for name, link := range devLinks {
+		if err := os.Symlink(link, filepath.Join("/dev", name)); err != nil {
+			return errors.Wrapf(err, "failed to create /dev/%s", name)
+		}
+	}
+
+	if err := unix.Mount("tmpfs", "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return &mount.Error{Op: "mount tmpfs", Target: "/dev/shm", Err: err}
+	}
+
+	// The queues are those of the new IPC namespace whether mounted or not,
+	// the mount only shows them
+	_ = unix.Mount("mqueue", "/dev/mqueue", "mqueue", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+
+	if err := unix.Mount("", "/dev", "", remountFlags("nosuid,nodev,noexec"), ""); err != nil {
+		return &mount.Error{Op: "remount read-only", Target: "/dev", Err: err}
+	}
+
+	return nil
+}
+
+// remountReadOnly makes a mount read-only and keeps its other flags, which
+// may not be cleared inside a user namespace. Mounts that are gone are left
+// out, and mounts out of reach give an error wrapping EACCES.
+func remountReadOnly(info *mount.Info) error {
+	err := unix.Mount("", info.Mountpoint, "", remountFlags(info.Options), "")
+
+	switch {
+	case err == nil, errors.Is(err, unix.ENOENT):
+		return nil
+	default:
+		return &mount.Error{Op: "remount read-only", Target: info.Mountpoint, Err: err}
+	}
+}
+
+// remountFlags returns the flags to remount a bind mount with the per-mount
+// options read-only, keeping the others.
+func remountFlags(options string) uintptr {
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+
+	for _, item := range strings.Split(options, ",") {
+		flags |= mountFlags[item]
+	}
+
+	return flags
+}
+
+var mountFlags = map[string]uintptr{
+	"nosuid":     unix.MS_NOSUID,
+	"nodev":      unix.MS_NODEV,
+	"noexec":     unix.MS_NOEXEC,
+	"noatime":    unix.MS_NOATIME,
+	"nodiratime": unix.MS_NODIRATIME,
+	"relatime":   unix.MS_RELATIME,
+}
+
+// loopbackUp brings up lo, which is down in a new network namespace. Nothing
+// is to be done when the host network is kept.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return errors.Wrap(err, "failed to open socket")
+	}
+
+	defer func() {
+		_ = unix.Close(fd)
+	}()
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return errors.Wrap(err, "failed to bring up loopback")
+	}
+
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return errors.Wrap(err, "failed to bring up loopback")
+	}
+
+	if ifr.Uint16()&unix.IFF_UP != 0 {
+		return nil
+	}
+
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return errors.Wrap(err, "failed to bring up loopback")
+	}
+
+	return nil
+}
+
+// isBelow reports whether name is dir or inside it.
+func isBelow(name, dir string) bool {
+	return name == dir || dir == "/" || strings.HasPrefix(name, dir+"/")
+}
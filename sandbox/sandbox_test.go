@@ -0,0 +1,49 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRemountFlags(t *testing.T) {
+	base := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+
+	tests := []struct {
+		options string
+		want    uintptr
+	}{
+		{"rw", base},
+		{"rw,relatime", base | unix.MS_RELATIME},
+		{"rw,nosuid,nodev,noexec,relatime", base | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC | unix.MS_RELATIME},
+		{"ro,noatime,nodiratime", base | unix.MS_NOATIME | unix.MS_NODIRATIME},
+	}
+
+	for _, test := range tests {
+		if got := remountFlags(test.options); got != test.want {
+			t.Errorf("remountFlags(%q) = %#x, want %#x", test.options, got, test.want)
+		}
+	}
+}
+
+func TestIsBelow(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+		want bool
+	}{
+		{"/tmp", "/tmp", true},
+		{"/tmp/ws", "/tmp", true},
+		{"/tmpfs", "/tmp", false},
+		{"/", "/tmp", false},
+		{"/home/user/ws", "/", true},
+	}
+
+	for _, test := range tests {
+		if got := isBelow(test.name, test.dir); got != test.want {
+			t.Errorf("isBelow(%q, %q) = %v, want %v", test.name, test.dir, got, test.want)
+		}
+	}
+}
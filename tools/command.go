@@ -0,0 +1,165 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/sandbox"
+)
+
+const (
+	defaultTimeout = 120 * time.Second
+)
+
+var gitStatusTool = Tool{
+	Name:        "git_status",
+	Description: "Show git status of the workspace",
+	Schema:      schema(nil, map[string]any{}),
+	ReadOnly:    true,
+	Run:         gitStatus,
+}
+
+var gitDiffTool = Tool{
+	Name:        "git_diff",
+	Description: "Show git diff of the workspace, optionally limited to a path",
+	Schema: schema(nil, map[string]any{
+		"path":   property("string", "limit the diff to this path"),
+		"staged": property("boolean", "show staged changes instead of unstaged ones"),
+	}),
+	ReadOnly: true,
+	Run:      gitDiff,
+}
+
+var runCommandTool = Tool{
+	Name:        "run_command",
+	Description: "Run a shell command with the workspace root as working directory",
+	Schema: schema([]string{"command"}, map[string]any{
+		"command": property("string", "command line passed to bash -c"),
+		"timeout": property("integer", "timeout in seconds (default 120)"),
+	}),
+	Run: func(ctx context.Context, root string, args json.RawMessage) (string, error) {
+		return runCommand(ctx, root, args, false)
+	},
+}
+
+// Sandboxed returns list with run_command running its commands in a sandbox,
+// where the workspace root is the only writable directory.
+func Sandboxed(list []Tool) []Tool {
+	out := append([]Tool(nil), list...)
+
+	for i := range out {
+		if out[i].Name == runCommandTool.Name {
+			out[i].Run = func(ctx context.Context, root string, args json.RawMessage) (string, error) {
+				return runCommand(ctx, root, args, true)
+			}
+		}
+	}
+
+	return out
+}
+
+func gitStatus(ctx context.Context, root string, _ json.RawMessage) (string, error) {
+	return git(ctx, root, "status", "--short", "--branch")
+}
+
+func gitDiff(ctx context.Context, root string, args json.RawMessage) (string, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Staged bool   `json:"staged"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	cmdArgs := []string{"diff", "--no-color"}
+	if params.Staged {
+		cmdArgs = append(cmdArgs, "--cached")
+	}
+
+	if params.Path != "" {
+		name, err := Resolve(root, params.Path)
+		if err != nil {
+			return "", err
+		}
+		cmdArgs = append(cmdArgs, "--", name)
+	}
+
+	output, err := git(ctx, root, cmdArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	if output == "" {
+		return "no changes", nil
+	}
+
+	return output, nil
+}
+
+func git(ctx context.Context, root string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = root
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(output)))
+	}
+
+	return truncate(string(output)), nil
+}
+
+func runCommand(ctx context.Context, root string, args json.RawMessage, sandboxed bool) (string, error) {
+	var params struct {
+		Command string `json:"command"`
+		Timeout int    `json:"timeout"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(params.Command) == "" {
+		return "", errors.New("command is required")
+	}
+
+	timeout := defaultTimeout
+	if params.Timeout > 0 {
+		timeout = time.Duration(params.Timeout) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", params.Command)
+	cmd.Dir = root
+
+	if sandboxed {
+		if err := sandbox.Wrap(cmd, sandbox.Options{Writable: root}); err != nil {
+			return "", err
+		}
+	}
+
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return truncate(string(output)) + fmt.Sprintf("\n(command timed out after %s)", timeout), nil
+	case errors.As(err, &exitErr):
+		return truncate(string(output)) + fmt.Sprintf("\n(exit code %d)", exitErr.ExitCode()), nil
+	case err != nil:
+		return "", err
+	}
+
+	return truncate(string(output)), nil
+}
@@ -0,0 +1,309 @@
+//go:build linux
+
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/repo-scm/git/utils"
+)
+
+const (
+	maxReadSize    = 256 * 1024
+	maxGrepMatches = 200
+)
+
+var readFileTool = Tool{
+	Name:        "read_file",
+	Description: "Read a text file from the workspace, optionally a range of lines",
+	Schema: schema([]string{"path"}, map[string]any{
+		"path":   property("string", "file path relative to the workspace root"),
+		"offset": property("integer", "first line to return, starting at 1"),
+		"limit":  property("integer", "maximum number of lines to return"),
+	}),
+	ReadOnly: true,
+	Run:      readFile,
+}
+
+var writeFileTool = Tool{
+	Name:        "write_file",
+	Description: "Create or overwrite a file in the workspace",
+	Schema: schema([]string{"path", "content"}, map[string]any{
+		"path":    property("string", "file path relative to the workspace root"),
+		"content": property("string", "full file content"),
+	}),
+	Run: writeFile,
+}
+
+var listDirTool = Tool{
+	Name:        "list_dir",
+	Description: "List entries of a directory in the workspace",
+	Schema: schema(nil, map[string]any{
+		"path": property("string", "directory path relative to the workspace root (default \".\")"),
+	}),
+	ReadOnly: true,
+	Run:      listDir,
+}
+
+var grepTool = Tool{
+	Name:        "grep",
+	Description: "Search workspace files for a regular expression",
+	Schema: schema([]string{"pattern"}, map[string]any{
+		"pattern": property("string", "RE2 regular expression"),
+		"path":    property("string", "directory or file to search (default \".\")"),
+		"include": property("string", "glob matched against file names, e.g. *.go"),
+	}),
+	ReadOnly: true,
+	Run:      grep,
+}
+
+func readFile(_ context.Context, root string, args json.RawMessage) (string, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	name, err := Resolve(root, params.Path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		return "", errors.Errorf("%s is a directory", params.Path)
+	}
+
+	if params.Offset <= 0 && params.Limit <= 0 {
+		if info.Size() > maxReadSize {
+			return "", errors.Errorf("%s is too large (%d bytes), read it with offset and limit", params.Path, info.Size())
+		}
+		buf, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	// Lines are counted from 1, a limit alone reads from the start
+	if params.Offset <= 0 {
+		params.Offset = 1
+	}
+
+	var b strings.Builder
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReadSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if line < params.Offset {
+			continue
+		}
+		if params.Limit > 0 && line >= params.Offset+params.Limit {
+			break
+		}
+		b.WriteString(scanner.Text())
+		b.WriteString("\n")
+	}
+
+	return truncate(b.String()), scanner.Err()
+}
+
+func writeFile(_ context.Context, root string, args json.RawMessage) (string, error) {
+	var params struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	name, err := Resolve(root, params.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), utils.PermDir); err != nil {
+		return "", err
+	}
+
+	perm := os.FileMode(utils.PermFile)
+	if info, err := os.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if err := os.WriteFile(name, []byte(params.Content), perm); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("wrote %d bytes to %s", len(params.Content), params.Path), nil
+}
+
+func listDir(_ context.Context, root string, args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	if params.Path == "" {
+		params.Path = "."
+	}
+
+	name, err := Resolve(root, params.Path)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+
+	for _, item := range entries {
+		if item.IsDir() {
+			lines = append(lines, item.Name()+"/")
+		} else {
+			lines = append(lines, item.Name())
+		}
+	}
+
+	sort.Strings(lines)
+
+	return truncate(strings.Join(lines, "\n")), nil
+}
+
+func grep(ctx context.Context, root string, args json.RawMessage) (string, error) {
+	var params struct {
+		Pattern string `json:"pattern"`
+		Path    string `json:"path"`
+		Include string `json:"include"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	re, err := regexp.Compile(params.Pattern)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid pattern")
+	}
+
+	if params.Path == "" {
+		params.Path = "."
+	}
+
+	base, err := Resolve(root, params.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+
+	errLimit := errors.New("limit reached")
+
+	err = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if params.Include != "" {
+			if ok, _ := filepath.Match(params.Include, d.Name()); !ok {
+				return nil
+			}
+		}
+		rel, _ := filepath.Rel(root, p)
+		found, err := grepFile(p, rel, re, maxGrepMatches-len(matches))
+		if err != nil {
+			return nil
+		}
+		matches = append(matches, found...)
+		if len(matches) >= maxGrepMatches {
+			return errLimit
+		}
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errLimit) {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "no matches", nil
+	}
+
+	return truncate(strings.Join(matches, "\n")), nil
+}
+
+func grepFile(name, rel string, re *regexp.Regexp, limit int) ([]string, error) {
+	var matches []string
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReadSize)
+
+	for line := 1; scanner.Scan() && len(matches) < limit; line++ {
+		text := scanner.Text()
+		if strings.IndexByte(text, 0) >= 0 {
+			// Binary file
+			return nil, nil
+		}
+		if re.MatchString(text) {
+			matches = append(matches, fmt.Sprintf("%s:%d:%s", rel, line, text))
+		}
+	}
+
+	return matches, nil
+}
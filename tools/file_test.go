@@ -0,0 +1,44 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte("1\n2\n3\n4\n5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{`{"path":"file"}`, "1\n2\n3\n4\n5\n"},
+		{`{"path":"file","limit":2}`, "1\n2\n"},
+		{`{"path":"file","offset":0,"limit":3}`, "1\n2\n3\n"},
+		{`{"path":"file","offset":-1,"limit":1}`, "1\n"},
+		{`{"path":"file","offset":2,"limit":2}`, "2\n3\n"},
+		{`{"path":"file","offset":4}`, "4\n5\n"},
+		{`{"path":"file","offset":1,"limit":10}`, "1\n2\n3\n4\n5\n"},
+		{`{"path":"file","offset":6,"limit":1}`, ""},
+	}
+
+	for _, test := range tests {
+		got, err := readFile(context.Background(), root, json.RawMessage(test.args))
+		if err != nil {
+			t.Errorf("readFile(%s) failed: %v", test.args, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("readFile(%s) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var applyPatchTool = Tool{
+	Name:        "apply_patch",
+	Description: "Apply a unified diff to the workspace, with paths relative to the workspace root",
+	Schema: schema([]string{"patch"}, map[string]any{
+		"patch": property("string", "unified diff, e.g. as produced by git diff"),
+	}),
+	Run: applyPatch,
+}
+
+func applyPatch(ctx context.Context, root string, args json.RawMessage) (string, error) {
+	var params struct {
+		Patch string `json:"patch"`
+	}
+
+	if err := decodeArgs(args, &params); err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(params.Patch) == "" {
+		return "", errors.New("patch is required")
+	}
+
+	patch := params.Patch
+	if !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+
+	// git apply refuses paths that leave the working directory, which keeps
+	// the patch inside the workspace
+	cmd := exec.CommandContext(ctx, "git", "apply", "--verbose", "--recount", "--whitespace=nowarn", "-")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(patch)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Errorf("failed to apply patch: %s", strings.TrimSpace(string(output)))
+	}
+
+	return truncate(strings.TrimSpace(string(output))), nil
+}
@@ -0,0 +1,151 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxOutput = 64 * 1024
+)
+
+// Tool is an operation confined to a workspace root, described by a JSON
+// schema so it can be advertised over MCP or to a model.
+type Tool struct {
+	Name        string
+	Description string
+	Schema      map[string]any
+	ReadOnly    bool
+	Run         func(ctx context.Context, root string, args json.RawMessage) (string, error)
+}
+
+func Builtin() []Tool {
+	return []Tool{
+		readFileTool,
+		writeFileTool,
+		applyPatchTool,
+		listDirTool,
+		grepTool,
+		gitStatusTool,
+		gitDiffTool,
+		runCommandTool,
+	}
+}
+
+func Find(list []Tool, name string) (Tool, bool) {
+	for _, item := range list {
+		if item.Name == name {
+			return item, true
+		}
+	}
+
+	return Tool{}, false
+}
+
+// Resolve maps name onto a path inside root, rejecting anything that escapes
+// it either lexically or through symlinks.
+func Resolve(root, name string) (string, error) {
+	if root == "" {
+		return "", errors.New("workspace root is required")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve workspace root")
+	}
+
+	target := name
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	target = filepath.Clean(target)
+
+	if !within(root, target) && !within(realRoot, target) {
+		return "", errors.Errorf("path %s is outside the workspace", name)
+	}
+
+	// Resolve the deepest existing ancestor so symlinks cannot point outside
+	existing := target
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve %s", name)
+	}
+
+	if !within(realRoot, resolved) {
+		return "", errors.Errorf("path %s is outside the workspace", name)
+	}
+
+	return target, nil
+}
+
+func within(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
+
+func decodeArgs(args json.RawMessage, v any) error {
+	if len(args) == 0 || string(args) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(args, v); err != nil {
+		return errors.Wrap(err, "invalid arguments")
+	}
+
+	return nil
+}
+
+func truncate(s string) string {
+	if len(s) <= maxOutput {
+		return s
+	}
+
+	return s[:maxOutput] + "\n... (output truncated)"
+}
+
+func schema(required []string, properties map[string]any) map[string]any {
+	s := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		s["required"] = required
+	}
+
+	return s
+}
+
+func property(kind, description string) map[string]any {
+	return map[string]any{
+		"type":        kind,
+		"description": description,
+	}
+}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+
+	for _, dir := range []string{filepath.Join(root, "dir"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{filepath.Join(root, "dir", "file"), filepath.Join(outside, "secret")} {
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		filepath.Join(root, "escape"):      filepath.Join(outside, "secret"),
+		filepath.Join(root, "escapedir"):   outside,
+		filepath.Join(root, "inside"):      "dir/file",
+		filepath.Join(root, "dangling"):    filepath.Join(outside, "missing"),
+		filepath.Join(base, "rootlink"):    root,
+		filepath.Join(root, "dir", "back"): "..",
+	}
+
+	for name, target := range links {
+		if err := os.Symlink(target, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		root string
+		name string
+		want string
+	}{
+		{root, "dir/file", filepath.Join(root, "dir", "file")},
+		{root, "dir/new", filepath.Join(root, "dir", "new")},
+		{root, "new/dir/file", filepath.Join(root, "new", "dir", "file")},
+		{root, ".", root},
+		{root, filepath.Join(root, "dir", "file"), filepath.Join(root, "dir", "file")},
+		{root, "dir/../dir/file", filepath.Join(root, "dir", "file")},
+		{root, "inside", filepath.Join(root, "inside")},
+		{root, "dir/back/dir/file", filepath.Join(root, "dir", "back", "dir", "file")},
+		{root, "../outside/secret", ""},
+		{root, "dir/../../outside/secret", ""},
+		{root, "..", ""},
+		{root, filepath.Join(outside, "secret"), ""},
+		{root, "/etc/passwd", ""},
+		{root, "escape", ""},
+		{root, "escapedir", ""},
+		{root, "escapedir/secret", ""},
+		{root, "escapedir/new", ""},
+		{root, "escapedir/new/file", ""},
+		{root, "dangling", ""},
+		{filepath.Join(base, "rootlink"), "dir/file", filepath.Join(base, "rootlink", "dir", "file")},
+		{filepath.Join(base, "rootlink"), "dir/new", filepath.Join(base, "rootlink", "dir", "new")},
+		{filepath.Join(base, "rootlink"), filepath.Join(root, "dir", "file"), filepath.Join(root, "dir", "file")},
+		{filepath.Join(base, "rootlink"), "../outside/secret", ""},
+		{filepath.Join(base, "rootlink"), "escapedir/new", ""},
+		{filepath.Join(base, "rootlink"), filepath.Join(outside, "secret"), ""},
+	}
+
+	for _, test := range tests {
+		got, err := Resolve(test.root, test.name)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Resolve(%q, %q) = %q, want error", test.root, test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q, %q) failed: %v", test.root, test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", test.root, test.name, got, test.want)
+		}
+	}
+
+	if _, err := Resolve("", "file"); err == nil {
+		t.Error("Resolve with empty root succeeded, want error")
+	}
+}
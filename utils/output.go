@@ -0,0 +1,85 @@
+//go:build linux
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	OutputTable = "table"
+	OutputWide  = "wide"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// ValidateOutput checks an --output value and a --format template before
+// any work is done for them.
+func ValidateOutput(output, format string) error {
+	switch output {
+	case "", OutputTable, OutputWide, OutputJSON, OutputYAML:
+	default:
+		return errors.Errorf("unknown output %s, must be one of table, wide, json or yaml", output)
+	}
+
+	if format != "" {
+		if output != "" && output != OutputTable {
+			return errors.New("--format cannot be combined with --output")
+		}
+		if _, err := template.New("format").Parse(format); err != nil {
+			return errors.Wrap(err, "invalid format template")
+		}
+	}
+
+	return nil
+}
+
+// WriteOutput writes items to stdout as JSON, YAML or once per item through
+// the format template. The table and wide outputs are left to text, which
+// gets whether the wide one was asked for.
+func WriteOutput[T any](_ context.Context, output, format string, items []T, text func(wide bool) error) error {
+	if items == nil {
+		items = []T{}
+	}
+
+	if format != "" {
+		tmpl, err := template.New("format").Parse(format)
+		if err != nil {
+			return errors.Wrap(err, "invalid format template")
+		}
+		for _, item := range items {
+			if err := tmpl.Execute(os.Stdout, item); err != nil {
+				return errors.Wrap(err, "failed to execute format template")
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+
+	switch output {
+	case OutputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case OutputYAML:
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(items); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case OutputWide:
+		return text(true)
+	case "", OutputTable:
+		return text(false)
+	default:
+		return errors.Errorf("unknown output %s, must be one of table, wide, json or yaml", output)
+	}
+}